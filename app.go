@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"DubaiCrab/internal/agent"
 	"DubaiCrab/internal/auth"
@@ -13,6 +16,7 @@ import (
 	"DubaiCrab/internal/ollama"
 	"DubaiCrab/internal/relay"
 	"DubaiCrab/internal/tools"
+	"DubaiCrab/internal/usage"
 
 	wailsRuntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -27,6 +31,7 @@ type App struct {
 	toolRegistry *tools.Registry
 	relay        *relay.Client
 	auth         *auth.OAuthManager
+	usage        *usage.Store
 }
 
 // NewApp creates a new App application struct
@@ -48,6 +53,16 @@ func (a *App) startup(ctx context.Context) {
 
 	// Initialize Ollama manager
 	a.ollama = ollama.NewManager()
+	a.ollama.SetEventHandler(func(name string, data interface{}) {
+		wailsRuntime.EventsEmit(ctx, name, data)
+	})
+	a.applyOllamaConfig()
+
+	// Record LLM usage locally
+	if dir, err := usage.DefaultDir(); err == nil {
+		a.usage = usage.NewStore(dir)
+		a.ollama.SetUsageRecorder(a.usage)
+	}
 
 	// Initialize tool registry
 	a.toolRegistry = tools.NewRegistry()
@@ -68,17 +83,15 @@ func (a *App) startup(ctx context.Context) {
 	a.agent = agent.NewAgent(a.ollama, a.toolRegistry)
 
 	// Initialize Kakao server
-	a.kakao = kakao.NewServer(a.ollama)
-	if cfg.KakaoEnabled {
-		a.kakao.UpdateConfig(&kakao.Config{
-			Enabled:      cfg.KakaoEnabled,
-			Port:         cfg.KakaoPort,
-			WebhookPath:  cfg.KakaoWebhookPath,
-			DMPolicy:     cfg.KakaoDMPolicy,
-			AllowFrom:    cfg.KakaoAllowFrom,
-			SystemPrompt: cfg.KakaoSystemPrompt,
-			Model:        cfg.KakaoModel,
-		})
+	a.kakao = kakao.NewServer(a.ollama, a.agent)
+	a.kakao.SetEventHandler(func(name string, data interface{}) {
+		wailsRuntime.EventsEmit(ctx, name, data)
+	})
+	if err := a.kakao.UpdateConfig(a.kakaoConfig()); err != nil {
+		log.Printf("Invalid Kakao config: %v", err)
+	}
+	if dir, err := kakao.DefaultDataDir(); err == nil {
+		a.kakao.SetDataDir(dir)
 	}
 
 	// Start services in background
@@ -97,17 +110,64 @@ func (a *App) startup(ctx context.Context) {
 				wailsRuntime.EventsEmit(ctx, "ollama:models", models)
 			}
 
-			// Start Kakao server
-			if cfg.KakaoEnabled {
-				log.Println("Starting Kakao webhook server...")
-				if err := a.kakao.Start(); err != nil {
-					log.Printf("Kakao server error: %v", err)
-				}
+			// Warm up models in the background so the first question is fast
+			if cfg.OllamaWarmup {
+				go a.ollama.WarmUp(cfg.OllamaModel, cfg.KakaoModel)
+			}
+
+			// Start Kakao server; it stays idle while disabled and
+			// follows later config updates
+			log.Println("Starting Kakao webhook server...")
+			if err := a.kakao.Start(); err != nil {
+				log.Printf("Kakao server error: %v", err)
 			}
 		}
 	}()
 }
 
+// applyOllamaConfig applies the configured connection, server environment,
+// worker pool and queue limits to the Ollama manager
+func (a *App) applyOllamaConfig() {
+	a.ollama.Configure(ollama.Settings{
+		BaseURL:     a.config.OllamaURL,
+		Username:    a.config.OllamaUsername,
+		Password:    a.config.OllamaPassword,
+		BearerToken: a.config.OllamaBearerToken,
+		KeepAlive:   a.config.OllamaKeepAlive,
+		Env: ollama.ServerEnv{
+			Models:          a.config.OllamaModelsDir,
+			Host:            a.config.OllamaHost,
+			KeepAlive:       a.config.OllamaKeepAlive,
+			NumParallel:     a.config.OllamaNumParallel,
+			MaxLoadedModels: a.config.OllamaMaxLoadedModels,
+		},
+	})
+
+	limits := make(map[ollama.Source]int, len(a.config.OllamaQueueLimits))
+	for src, n := range a.config.OllamaQueueLimits {
+		limits[ollama.Source(src)] = n
+	}
+	a.ollama.Scheduler().Configure(a.config.OllamaWorkers, limits)
+
+	cacheCfg := ollama.DefaultCacheConfig()
+	cacheCfg.Enabled = a.config.ResponseCacheEnabled
+	if a.config.ResponseCacheTTLMinutes > 0 {
+		cacheCfg.TTL = time.Duration(a.config.ResponseCacheTTLMinutes) * time.Minute
+	}
+	if a.config.ResponseCacheMaxEntries > 0 {
+		cacheCfg.MaxEntries = a.config.ResponseCacheMaxEntries
+	}
+	cacheCfg.Sources = nil
+	for _, src := range a.config.ResponseCacheSources {
+		cacheCfg.Sources = append(cacheCfg.Sources, ollama.Source(src))
+	}
+	cacheCfg.Semantic = a.config.ResponseCacheSemantic
+	if a.config.ResponseCacheThreshold > 0 {
+		cacheCfg.SimilarityThreshold = a.config.ResponseCacheThreshold
+	}
+	a.ollama.ResponseCache().Configure(cacheCfg)
+}
+
 // shutdown is called when the app is closing
 func (a *App) shutdown(ctx context.Context) {
 	log.Println("Shutting down...")
@@ -162,16 +222,109 @@ func (a *App) GetOllamaModels() ([]string, error) {
 	return a.ollama.ListModels()
 }
 
+// OllamaQueueStatus represents the Ollama request queue state
+type OllamaQueueStatus struct {
+	Active int `json:"active"`
+	Queued int `json:"queued"`
+}
+
+// GetOllamaQueueStatus returns the number of running and waiting LLM requests
+func (a *App) GetOllamaQueueStatus() OllamaQueueStatus {
+	active, queued := a.ollama.Scheduler().Stats()
+	return OllamaQueueStatus{Active: active, Queued: queued}
+}
+
 // PullOllamaModel downloads a model
 func (a *App) PullOllamaModel(modelName string) error {
 	return a.ollama.PullModel(modelName)
 }
 
+// EnsureEmbeddingModel downloads the default embedding model if missing
+func (a *App) EnsureEmbeddingModel() error {
+	return a.ollama.EnsureEmbedModel()
+}
+
 // StartOllama starts Ollama server
 func (a *App) StartOllama() error {
 	return a.ollama.Start(a.ctx)
 }
 
+// GetLoadedModels returns the models Ollama currently holds in memory
+func (a *App) GetLoadedModels() ([]ollama.LoadedModel, error) {
+	return a.ollama.LoadedModels()
+}
+
+// UnloadOllamaModel frees the memory used by a model. An empty name unloads
+// every loaded model.
+func (a *App) UnloadOllamaModel(modelName string) error {
+	if modelName != "" {
+		return a.ollama.Unload(modelName)
+	}
+
+	loaded, err := a.ollama.LoadedModels()
+	if err != nil {
+		return err
+	}
+	for _, m := range loaded {
+		if err := a.ollama.Unload(m.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WarmUpOllamaModels loads the default and Kakao models into memory
+func (a *App) WarmUpOllamaModels() {
+	a.ollama.WarmUp(a.config.OllamaModel, a.config.KakaoModel)
+}
+
+// GetResponseCacheStats returns response cache counters
+func (a *App) GetResponseCacheStats() ollama.CacheStats {
+	return a.ollama.ResponseCache().Stats()
+}
+
+// GetResponseCacheEntries returns the cached responses
+func (a *App) GetResponseCacheEntries() []ollama.CacheEntry {
+	return a.ollama.ResponseCache().Entries()
+}
+
+// FlushResponseCache drops every cached response
+func (a *App) FlushResponseCache() {
+	a.ollama.ResponseCache().Flush()
+}
+
+// GetUsageStats returns LLM usage aggregated per day, model and source.
+// rangeName is "today" or a number of days such as "7d" or "30d".
+func (a *App) GetUsageStats(rangeName string) (*usage.Stats, error) {
+	if a.usage == nil {
+		return nil, fmt.Errorf("usage store unavailable")
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := today.AddDate(0, 0, -6)
+
+	switch {
+	case rangeName == "today":
+		from = today
+	case strings.HasSuffix(rangeName, "d"):
+		days, err := strconv.Atoi(strings.TrimSuffix(rangeName, "d"))
+		if err != nil || days <= 0 {
+			return nil, fmt.Errorf("invalid range: %s", rangeName)
+		}
+		from = today.AddDate(0, 0, -(days - 1))
+	case rangeName != "":
+		return nil, fmt.Errorf("invalid range: %s", rangeName)
+	}
+
+	return a.usage.Stats(from, now.Add(time.Second))
+}
+
+// GetOllamaLogs returns the recent output of the managed Ollama process
+func (a *App) GetOllamaLogs() []string {
+	return a.ollama.Logs()
+}
+
 // ============================================
 // Chat Commands
 // ============================================
@@ -189,7 +342,8 @@ func (a *App) Chat(sessionID, message string) (string, error) {
 		sessionID = "default"
 	}
 
-	response, err := a.agent.ProcessMessage(a.ctx, sessionID, message)
+	ctx := ollama.WithSource(a.ctx, ollama.SourceDesktop)
+	response, err := a.agent.ProcessMessage(ctx, sessionID, message)
 	if err != nil {
 		return "", err
 	}
@@ -197,6 +351,62 @@ func (a *App) Chat(sessionID, message string) (string, error) {
 	return response, nil
 }
 
+// ChatWithImageFile sends a message with an image file attached. Vision
+// models receive the image itself; other models get its OCR text.
+func (a *App) ChatWithImageFile(sessionID, imagePath, message string) (string, error) {
+	if a.ollama.SupportsVision(a.agent.Model()) {
+		image, err := tools.LoadImageBase64(imagePath)
+		if err != nil {
+			return "", err
+		}
+		return a.chatWithImages(sessionID, message, []string{image})
+	}
+
+	return a.chatWithOcrText(sessionID, message, tools.OcrFromFile(imagePath, "kor+eng"))
+}
+
+// ChatWithImageData sends a message with a base64 image attached, e.g. one
+// pasted from the clipboard
+func (a *App) ChatWithImageData(sessionID, base64Data, message string) (string, error) {
+	if a.ollama.SupportsVision(a.agent.Model()) {
+		return a.chatWithImages(sessionID, message, []string{tools.StripDataURL(base64Data)})
+	}
+
+	return a.chatWithOcrText(sessionID, message, tools.OcrFromBase64(base64Data, "kor+eng"))
+}
+
+func (a *App) chatWithImages(sessionID, message string, images []string) (string, error) {
+	if sessionID == "" {
+		sessionID = "default"
+	}
+	if message == "" {
+		message = "이 이미지를 설명해 주세요."
+	}
+
+	ctx := ollama.WithSource(a.ctx, ollama.SourceDesktop)
+	return a.agent.ProcessMessageWithImages(ctx, sessionID, message, images)
+}
+
+// chatWithOcrText falls back to sending the image's OCR text
+func (a *App) chatWithOcrText(sessionID, message string, ocr tools.OcrResult) (string, error) {
+	if !ocr.Success {
+		if ocr.Error != nil {
+			return "", fmt.Errorf("%s", *ocr.Error)
+		}
+		return "", fmt.Errorf("OCR 실패")
+	}
+
+	text := ""
+	if ocr.Text != nil {
+		text = *ocr.Text
+	}
+	if message == "" {
+		message = "이 이미지의 내용을 정리해 주세요."
+	}
+
+	return a.Chat(sessionID, fmt.Sprintf("%s\n\n[첨부 이미지에서 추출한 텍스트]\n%s", message, text))
+}
+
 // SimpleChat sends a simple chat without session management
 func (a *App) SimpleChat(model, message string) (string, error) {
 	if model == "" {
@@ -204,7 +414,8 @@ func (a *App) SimpleChat(model, message string) (string, error) {
 	}
 
 	systemPrompt := "당신은 Dubai Crab, 한국 사무직을 위한 친절한 AI 비서입니다."
-	return a.ollama.Chat(a.ctx, model, message, &systemPrompt)
+	ctx := ollama.WithSource(a.ctx, ollama.SourceDesktop)
+	return a.ollama.Chat(ctx, model, message, &systemPrompt)
 }
 
 // GetChatHistory returns chat history for a session
@@ -239,10 +450,13 @@ func (a *App) ClearChatHistory(sessionID string) {
 
 // KakaoStatus represents Kakao server status
 type KakaoStatus struct {
-	Running     bool   `json:"running"`
-	Enabled     bool   `json:"enabled"`
-	Port        int    `json:"port"`
-	WebhookPath string `json:"webhookPath"`
+	State       kakao.State       `json:"state"`
+	Error       string            `json:"error,omitempty"`
+	Running     bool              `json:"running"`
+	Enabled     bool              `json:"enabled"`
+	Port        int               `json:"port"`
+	WebhookPath string            `json:"webhookPath"`
+	Bots        []kakao.BotStatus `json:"bots"`
 }
 
 // StartKakaoServer starts the Kakao webhook server
@@ -260,49 +474,160 @@ func (a *App) StopKakaoServer() error {
 func (a *App) GetKakaoStatus() KakaoStatus {
 	status := a.kakao.GetStatus()
 	return KakaoStatus{
+		State:       status.State,
+		Error:       status.Error,
 		Running:     status.Running,
 		Enabled:     status.Enabled,
 		Port:        status.Port,
 		WebhookPath: status.WebhookPath,
+		Bots:        status.Bots,
 	}
 }
 
+// GetKakaoDeadLetters returns Kakao callback replies that could not be
+// delivered
+func (a *App) GetKakaoDeadLetters() ([]kakao.DeadLetter, error) {
+	return a.kakao.DeadLetters()
+}
+
+// ClearKakaoDeadLetters deletes the undelivered callback log
+func (a *App) ClearKakaoDeadLetters() error {
+	return a.kakao.ClearDeadLetters()
+}
+
+// GetKakaoAuditLog returns the most recent rejected webhook requests
+func (a *App) GetKakaoAuditLog(limit int) ([]kakao.AuditEntry, error) {
+	return a.kakao.AuditLog(limit)
+}
+
+// GetKakaoPairingCode returns the code Kakao users send to pair with the bot
+func (a *App) GetKakaoPairingCode() kakao.PairingCode {
+	return a.kakao.PairingCode()
+}
+
+// GetKakaoPairingRequests returns users waiting for pairing approval
+func (a *App) GetKakaoPairingRequests() []kakao.PairingRequest {
+	return a.kakao.PairingRequests()
+}
+
+// ApproveKakaoPairing allows a Kakao user on a bot under the given display name
+func (a *App) ApproveKakaoPairing(bot, senderID, displayName string) error {
+	return a.kakao.ApprovePairing(bot, senderID, displayName)
+}
+
+// RejectKakaoPairing drops a pending pairing request
+func (a *App) RejectKakaoPairing(bot, senderID string) {
+	a.kakao.RejectPairing(bot, senderID)
+}
+
+// RevokeKakaoPairing removes a paired Kakao user
+func (a *App) RevokeKakaoPairing(bot, senderID string) error {
+	return a.kakao.RevokePairing(bot, senderID)
+}
+
+// GetKakaoPairedUsers returns the paired Kakao users
+func (a *App) GetKakaoPairedUsers() []kakao.PairedUser {
+	return a.kakao.PairedUsers()
+}
+
+// GetKakaoConversations searches the Kakao conversation log, newest first
+func (a *App) GetKakaoConversations(query kakao.ConversationQuery) (*kakao.ConversationPage, error) {
+	return a.kakao.Conversations(query)
+}
+
+// TakeOverKakaoConversation stops the bot from answering a Kakao user so an
+// admin can reply from the inbox
+func (a *App) TakeOverKakaoConversation(bot, senderID string) {
+	a.kakao.TakeOver(bot, senderID)
+}
+
+// ReleaseKakaoConversation hands a Kakao conversation back to the bot
+func (a *App) ReleaseKakaoConversation(bot, senderID string) {
+	a.kakao.Release(bot, senderID)
+}
+
+// GetKakaoTakenOver returns the Kakao users an admin is answering
+func (a *App) GetKakaoTakenOver() []kakao.TakenOverUser {
+	return a.kakao.TakenOver()
+}
+
+// SendKakaoReply sends an admin's reply to a taken-over Kakao conversation
+func (a *App) SendKakaoReply(bot, senderID, text string) error {
+	return a.kakao.SendReply(bot, senderID, text)
+}
+
+// SimulateKakao sends a simulated Open Builder skill request to the local
+// Kakao webhook and returns the raw exchange with a text preview
+func (a *App) SimulateKakao(req kakao.SimulatorRequest) (*kakao.SimulatorResult, error) {
+	return a.kakao.Simulate(req)
+}
+
 // KakaoConfig represents Kakao configuration for frontend
 type KakaoConfigJS struct {
-	Enabled      bool     `json:"enabled"`
-	Port         int      `json:"port"`
-	WebhookPath  string   `json:"webhookPath"`
-	DMPolicy     string   `json:"dmPolicy"`
-	AllowFrom    []string `json:"allowFrom"`
-	SystemPrompt string   `json:"systemPrompt"`
-	Model        string   `json:"model"`
+	Enabled            bool                     `json:"enabled"`
+	Port               int                      `json:"port"`
+	WebhookPath        string                   `json:"webhookPath"`
+	DMPolicy           string                   `json:"dmPolicy"`
+	AllowFrom          []string                 `json:"allowFrom"`
+	SystemPrompt       string                   `json:"systemPrompt"`
+	Model              string                   `json:"model"`
+	AllowedTools       []string                 `json:"allowedTools"`
+	SessionIdleMinutes int                      `json:"sessionIdleMinutes"`
+	ReplyTimeoutMs     int                      `json:"replyTimeoutMs"`
+	RichReplies        bool                     `json:"richReplies"`
+	Attachments        bool                     `json:"attachments"`
+	MaxAttachmentMB    int                      `json:"maxAttachmentMb"`
+	ConversationLog    bool                     `json:"conversationLog"`
+	LogRetentionDays   int                      `json:"logRetentionDays"`
+	WebhookSecret      string                   `json:"webhookSecret"`
+	AllowedIPs         []string                 `json:"allowedIps"`
+	TrustForwardedFor  bool                     `json:"trustForwardedFor"`
+	BotID              string                   `json:"botId"`
+	RateLimit          kakao.RateLimit          `json:"rateLimit"`
+	Admins             []string                 `json:"admins"`
+	AllowedModels      []string                 `json:"allowedModels"`
+	Profiles           map[string]kakao.Profile `json:"profiles"`
+	CommandPermissions map[string]string        `json:"commandPermissions"`
+	Bots               []kakao.Bot              `json:"bots"`
+	Routes             []kakao.Route            `json:"routes"`
 }
 
 // GetKakaoConfig returns Kakao configuration
 func (a *App) GetKakaoConfig() KakaoConfigJS {
 	cfg := a.kakao.GetConfig()
 	return KakaoConfigJS{
-		Enabled:      cfg.Enabled,
-		Port:         cfg.Port,
-		WebhookPath:  cfg.WebhookPath,
-		DMPolicy:     cfg.DMPolicy,
-		AllowFrom:    cfg.AllowFrom,
-		SystemPrompt: cfg.SystemPrompt,
-		Model:        cfg.Model,
+		Enabled:            cfg.Enabled,
+		Port:               cfg.Port,
+		WebhookPath:        cfg.WebhookPath,
+		DMPolicy:           cfg.DMPolicy,
+		AllowFrom:          cfg.AllowFrom,
+		SystemPrompt:       cfg.SystemPrompt,
+		Model:              cfg.Model,
+		AllowedTools:       cfg.AllowedTools,
+		SessionIdleMinutes: cfg.SessionIdleMinutes,
+		ReplyTimeoutMs:     cfg.ReplyTimeoutMs,
+		RichReplies:        cfg.RichReplies,
+		Attachments:        cfg.Attachments,
+		MaxAttachmentMB:    cfg.MaxAttachmentMB,
+		ConversationLog:    cfg.ConversationLog,
+		LogRetentionDays:   cfg.LogRetentionDays,
+		WebhookSecret:      cfg.WebhookSecret,
+		AllowedIPs:         cfg.AllowedIPs,
+		TrustForwardedFor:  cfg.TrustForwardedFor,
+		BotID:              cfg.BotID,
+		RateLimit:          cfg.RateLimit,
+		Admins:             cfg.Admins,
+		AllowedModels:      cfg.AllowedModels,
+		Profiles:           cfg.Profiles,
+		CommandPermissions: cfg.CommandPermissions,
+		Bots:               cfg.Bots,
+		Routes:             cfg.Routes,
 	}
 }
 
 // UpdateKakaoConfig updates Kakao configuration
 func (a *App) UpdateKakaoConfig(cfg KakaoConfigJS) error {
-	a.kakao.UpdateConfig(&kakao.Config{
-		Enabled:      cfg.Enabled,
-		Port:         cfg.Port,
-		WebhookPath:  cfg.WebhookPath,
-		DMPolicy:     cfg.DMPolicy,
-		AllowFrom:    cfg.AllowFrom,
-		SystemPrompt: cfg.SystemPrompt,
-		Model:        cfg.Model,
-	})
+	prev := *a.config
 
 	// Update app config
 	a.config.KakaoEnabled = cfg.Enabled
@@ -312,10 +637,114 @@ func (a *App) UpdateKakaoConfig(cfg KakaoConfigJS) error {
 	a.config.KakaoAllowFrom = cfg.AllowFrom
 	a.config.KakaoSystemPrompt = cfg.SystemPrompt
 	a.config.KakaoModel = cfg.Model
+	a.config.KakaoAllowedTools = cfg.AllowedTools
+	a.config.KakaoSessionIdleMinutes = cfg.SessionIdleMinutes
+	a.config.KakaoReplyTimeoutMs = cfg.ReplyTimeoutMs
+	a.config.KakaoRichReplies = cfg.RichReplies
+	a.config.KakaoAttachments = cfg.Attachments
+	a.config.KakaoMaxAttachmentMB = cfg.MaxAttachmentMB
+	a.config.KakaoConversationLog = cfg.ConversationLog
+	a.config.KakaoLogRetentionDays = cfg.LogRetentionDays
+	a.config.KakaoWebhookSecret = cfg.WebhookSecret
+	a.config.KakaoAllowedIPs = cfg.AllowedIPs
+	a.config.KakaoTrustForwardedFor = cfg.TrustForwardedFor
+	a.config.KakaoBotID = cfg.BotID
+	a.config.KakaoRateLimit = config.KakaoRateLimit(cfg.RateLimit)
+	a.config.KakaoAdmins = cfg.Admins
+	a.config.KakaoAllowedModels = cfg.AllowedModels
+	a.config.KakaoProfiles = make(map[string]config.KakaoProfile, len(cfg.Profiles))
+	for name, p := range cfg.Profiles {
+		a.config.KakaoProfiles[name] = config.KakaoProfile(p)
+	}
+	a.config.KakaoCommandPermissions = cfg.CommandPermissions
+	a.config.KakaoBots = make([]config.KakaoBot, len(cfg.Bots))
+	for i, b := range cfg.Bots {
+		a.config.KakaoBots[i] = config.KakaoBot{
+			Name:         b.Name,
+			WebhookPath:  b.WebhookPath,
+			BotID:        b.BotID,
+			DMPolicy:     b.DMPolicy,
+			AllowFrom:    b.AllowFrom,
+			SystemPrompt: b.SystemPrompt,
+			Model:        b.Model,
+			Profile:      b.Profile,
+		}
+		if b.RateLimit != nil {
+			limit := config.KakaoRateLimit(*b.RateLimit)
+			a.config.KakaoBots[i].RateLimit = &limit
+		}
+	}
+	a.config.KakaoRoutes = make([]config.KakaoRoute, len(cfg.Routes))
+	for i, r := range cfg.Routes {
+		a.config.KakaoRoutes[i] = config.KakaoRoute(r)
+	}
 
+	if err := a.kakao.UpdateConfig(a.kakaoConfig()); err != nil {
+		*a.config = prev
+		return err
+	}
 	return a.config.Save()
 }
 
+// kakaoConfig builds the Kakao server configuration from the app config
+func (a *App) kakaoConfig() *kakao.Config {
+	cfg := a.config
+	profiles := make(map[string]kakao.Profile, len(cfg.KakaoProfiles))
+	for name, p := range cfg.KakaoProfiles {
+		profiles[name] = kakao.Profile(p)
+	}
+	bots := make([]kakao.Bot, len(cfg.KakaoBots))
+	for i, b := range cfg.KakaoBots {
+		bots[i] = kakao.Bot{
+			Name:         b.Name,
+			WebhookPath:  b.WebhookPath,
+			BotID:        b.BotID,
+			DMPolicy:     b.DMPolicy,
+			AllowFrom:    b.AllowFrom,
+			SystemPrompt: b.SystemPrompt,
+			Model:        b.Model,
+			Profile:      b.Profile,
+		}
+		if b.RateLimit != nil {
+			limit := kakao.RateLimit(*b.RateLimit)
+			bots[i].RateLimit = &limit
+		}
+	}
+	routes := make([]kakao.Route, len(cfg.KakaoRoutes))
+	for i, r := range cfg.KakaoRoutes {
+		routes[i] = kakao.Route(r)
+	}
+
+	return &kakao.Config{
+		Enabled:            cfg.KakaoEnabled,
+		Port:               cfg.KakaoPort,
+		WebhookPath:        cfg.KakaoWebhookPath,
+		DMPolicy:           cfg.KakaoDMPolicy,
+		AllowFrom:          cfg.KakaoAllowFrom,
+		SystemPrompt:       cfg.KakaoSystemPrompt,
+		Model:              cfg.KakaoModel,
+		AllowedTools:       cfg.KakaoAllowedTools,
+		SessionIdleMinutes: cfg.KakaoSessionIdleMinutes,
+		ReplyTimeoutMs:     cfg.KakaoReplyTimeoutMs,
+		RichReplies:        cfg.KakaoRichReplies,
+		Attachments:        cfg.KakaoAttachments,
+		MaxAttachmentMB:    cfg.KakaoMaxAttachmentMB,
+		ConversationLog:    cfg.KakaoConversationLog,
+		LogRetentionDays:   cfg.KakaoLogRetentionDays,
+		WebhookSecret:      cfg.KakaoWebhookSecret,
+		AllowedIPs:         cfg.KakaoAllowedIPs,
+		TrustForwardedFor:  cfg.KakaoTrustForwardedFor,
+		BotID:              cfg.KakaoBotID,
+		RateLimit:          kakao.RateLimit(cfg.KakaoRateLimit),
+		Admins:             cfg.KakaoAdmins,
+		AllowedModels:      cfg.KakaoAllowedModels,
+		Profiles:           profiles,
+		CommandPermissions: cfg.KakaoCommandPermissions,
+		Bots:               bots,
+		Routes:             routes,
+	}
+}
+
 // ============================================
 // File Commands
 // ============================================
@@ -386,7 +815,13 @@ func (a *App) GetConfig() *config.Config {
 
 // SaveConfig saves the configuration
 func (a *App) SaveConfig(cfg *config.Config) error {
+	prev := a.config
 	a.config = cfg
+	if err := a.kakao.UpdateConfig(a.kakaoConfig()); err != nil {
+		a.config = prev
+		return err
+	}
+	a.applyOllamaConfig()
 	return cfg.Save()
 }
 
@@ -494,7 +929,8 @@ func (a *App) ConnectRelay(code string) (RelayStatus, error) {
 	// Set message handler
 	a.relay.SetHandler(func(msg relay.RelayMessage) (string, error) {
 		// Process message through Ollama
-		response, err := a.agent.ProcessMessage(a.ctx, msg.SessionID, msg.Content)
+		ctx := ollama.WithSource(a.ctx, ollama.SourceRelay)
+		response, err := a.agent.ProcessMessage(ctx, msg.SessionID, msg.Content)
 		if err != nil {
 			return "", err
 		}
@@ -20,6 +20,9 @@ type Message struct {
 	Timestamp time.Time `json:"timestamp"`
 	ToolName  string    `json:"toolName,omitempty"`
 	ToolCall  string    `json:"toolCall,omitempty"`
+	// ImageCount is the number of images attached to this turn; the image
+	// data itself is not kept in the history
+	ImageCount int `json:"imageCount,omitempty"`
 }
 
 // Session represents a conversation session
@@ -117,28 +120,59 @@ func (a *Agent) ClearSession(sessionID string) {
 	delete(a.sessions, sessionID)
 }
 
+// Model returns the model used for conversations
+func (a *Agent) Model() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.model
+}
+
+// RunOptions overrides the agent configuration for a single message, so
+// other channels (e.g. Kakao) can share the agent with their own settings
+type RunOptions struct {
+	Model        string   // empty uses the agent model
+	SystemPrompt string   // empty uses the agent system prompt
+	Images       []string // base64-encoded images for a vision model
+
+	// AllowedTools restricts which tools the model may call; nil allows
+	// every registered tool and an empty slice allows none
+	AllowedTools []string
+}
+
 // ProcessMessage processes a user message and returns the response
 func (a *Agent) ProcessMessage(ctx context.Context, sessionID, userMessage string) (string, error) {
+	return a.ProcessMessageWithOptions(ctx, sessionID, userMessage, RunOptions{})
+}
+
+// ProcessMessageWithImages processes a user message with base64-encoded
+// images attached for a vision-capable model
+func (a *Agent) ProcessMessageWithImages(ctx context.Context, sessionID, userMessage string, images []string) (string, error) {
+	return a.ProcessMessageWithOptions(ctx, sessionID, userMessage, RunOptions{Images: images})
+}
+
+// ProcessMessageWithOptions processes a user message with per-call overrides
+func (a *Agent) ProcessMessageWithOptions(ctx context.Context, sessionID, userMessage string, opts RunOptions) (string, error) {
 	session := a.GetOrCreateSession(sessionID)
 	
 	// Add user message
 	a.addMessage(session, Message{
-		Role:      "user",
-		Content:   userMessage,
-		Timestamp: time.Now(),
+		Role:       "user",
+		Content:    userMessage,
+		Timestamp:  time.Now(),
+		ImageCount: len(opts.Images),
 	})
 	
 	// Build context
 	messages := a.buildContext(session)
 	
 	// Get response from LLM
-	response, err := a.ollama.Chat(ctx, a.model, a.formatMessages(messages), &a.systemPrompt)
+	response, err := a.chat(ctx, messages, opts)
 	if err != nil {
 		return "", fmt.Errorf("failed to get response: %w", err)
 	}
 	
 	// Check for tool calls (simple pattern matching for now)
-	if toolCall := a.extractToolCall(response); toolCall != nil {
+	if toolCall := a.extractToolCall(response, opts.AllowedTools); toolCall != nil {
 		toolResult, err := a.executeToolCall(ctx, toolCall)
 		if err != nil {
 			log.Printf("[agent] Tool execution failed: %v", err)
@@ -160,7 +194,7 @@ func (a *Agent) ProcessMessage(ctx context.Context, sessionID, userMessage strin
 			
 			// Get final response incorporating tool result
 			messages = a.buildContext(session)
-			response, err = a.ollama.Chat(ctx, a.model, a.formatMessages(messages), &a.systemPrompt)
+			response, err = a.chat(ctx, messages, opts)
 			if err != nil {
 				return "", fmt.Errorf("failed to get final response: %w", err)
 			}
@@ -205,22 +239,47 @@ func (a *Agent) buildContext(session *Session) []Message {
 	return messages
 }
 
-// formatMessages formats messages for the LLM
-func (a *Agent) formatMessages(messages []Message) string {
-	var parts []string
+// chat sends the conversation to the LLM as separate role messages,
+// attaching any images to the latest user turn
+func (a *Agent) chat(ctx context.Context, messages []Message, opts RunOptions) (string, error) {
+	a.mu.RLock()
+	model := a.model
+	systemPrompt := a.systemPrompt
+	a.mu.RUnlock()
+
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	if opts.SystemPrompt != "" {
+		systemPrompt = opts.SystemPrompt
+	}
+
+	var chatMessages []ollama.ChatMessage
+	if systemPrompt != "" {
+		chatMessages = append(chatMessages, ollama.ChatMessage{
+			Role:    "system",
+			Content: systemPrompt,
+		})
+	}
+	lastUser := -1
 	for _, msg := range messages {
-		prefix := ""
-		switch msg.Role {
-		case "user":
-			prefix = "사용자: "
-		case "assistant":
-			prefix = "비서: "
-		case "tool":
-			prefix = fmt.Sprintf("[%s 결과]: ", msg.ToolName)
+		content := msg.Content
+		if msg.Role == "tool" {
+			content = fmt.Sprintf("[%s 결과]: %s", msg.ToolName, msg.Content)
+		}
+		if msg.Role == "user" {
+			lastUser = len(chatMessages)
 		}
-		parts = append(parts, prefix+msg.Content)
+		chatMessages = append(chatMessages, ollama.ChatMessage{
+			Role:    msg.Role,
+			Content: content,
+		})
 	}
-	return strings.Join(parts, "\n\n")
+	if lastUser >= 0 {
+		chatMessages[lastUser].Images = opts.Images
+	}
+
+	return a.ollama.ChatMessages(ctx, model, chatMessages)
 }
 
 // ToolCall represents a tool call
@@ -229,8 +288,9 @@ type ToolCall struct {
 	Params map[string]interface{} `json:"params"`
 }
 
-// extractToolCall extracts a tool call from the response (simple pattern matching)
-func (a *Agent) extractToolCall(response string) *ToolCall {
+// extractToolCall extracts a tool call from the response (simple pattern
+// matching). Tools outside allowed are ignored unless allowed is nil.
+func (a *Agent) extractToolCall(response string, allowed []string) *ToolCall {
 	// Look for tool call patterns like: @tool_name({"param": "value"})
 	if !strings.Contains(response, "@") {
 		return nil
@@ -252,6 +312,10 @@ func (a *Agent) extractToolCall(response string) *ToolCall {
 	if !a.toolRegistry.Has(toolName) {
 		return nil
 	}
+	if allowed != nil && !containsString(allowed, toolName) {
+		log.Printf("[agent] Tool %s is not allowed here", toolName)
+		return nil
+	}
 	
 	// Find matching closing paren
 	closeIdx := strings.LastIndex(rest, ")")
@@ -287,6 +351,16 @@ func (a *Agent) executeToolCall(ctx context.Context, call *ToolCall) (string, er
 	return result, nil
 }
 
+// RunTool executes a registered tool directly, outside the conversation
+func (a *Agent) RunTool(ctx context.Context, name string, params map[string]interface{}) (string, error) {
+	return a.executeToolCall(ctx, &ToolCall{Name: name, Params: params})
+}
+
+// HasTool reports whether a tool is registered
+func (a *Agent) HasTool(name string) bool {
+	return a.toolRegistry.Has(name)
+}
+
 // GetSessionHistory returns the message history for a session
 func (a *Agent) GetSessionHistory(sessionID string) []Message {
 	a.mu.RLock()
@@ -303,6 +377,23 @@ func (a *Agent) GetSessionHistory(sessionID string) []Message {
 	return messages
 }
 
+// ExpireSessions removes sessions whose ID starts with prefix and that have
+// been idle for longer than idle, returning the removed IDs
+func (a *Agent) ExpireSessions(prefix string, idle time.Duration) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := time.Now().Add(-idle)
+	var expired []string
+	for id, session := range a.sessions {
+		if strings.HasPrefix(id, prefix) && session.UpdatedAt.Before(cutoff) {
+			delete(a.sessions, id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
 // ListSessions returns all session IDs
 func (a *Agent) ListSessions() []string {
 	a.mu.RLock()
@@ -314,3 +405,12 @@ func (a *Agent) ListSessions() []string {
 	}
 	return ids
 }
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
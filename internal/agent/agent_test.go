@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"DubaiCrab/internal/ollama"
+	"DubaiCrab/internal/ollama/ollamatest"
+	"DubaiCrab/internal/tools"
+)
+
+type stubTool struct {
+	calls []map[string]interface{}
+}
+
+func (t *stubTool) Name() string                   { return "stub" }
+func (t *stubTool) Description() string            { return "test tool" }
+func (t *stubTool) Schema() map[string]interface{} { return map[string]interface{}{} }
+func (t *stubTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	t.calls = append(t.calls, params)
+	return "stub result", nil
+}
+
+func newTestAgent(t *testing.T) (*Agent, *ollamatest.Server, *stubTool) {
+	t.Helper()
+	srv := ollamatest.NewServer()
+	t.Cleanup(srv.Close)
+
+	m := ollama.NewManager()
+	m.SetBaseURL(srv.URL)
+
+	tool := &stubTool{}
+	registry := tools.NewRegistry()
+	registry.Register(tool)
+
+	return NewAgent(m, registry), srv, tool
+}
+
+func TestProcessMessageKeepsHistory(t *testing.T) {
+	a, srv, _ := newTestAgent(t)
+	srv.SetChatReply("네, 알겠습니다.")
+
+	for _, msg := range []string{"첫 번째 질문", "두 번째 질문"} {
+		if _, err := a.ProcessMessage(context.Background(), "s1", msg); err != nil {
+			t.Fatalf("ProcessMessage: %v", err)
+		}
+	}
+
+	history := a.GetSessionHistory("s1")
+	if len(history) != 4 {
+		t.Fatalf("history has %d messages, want 4", len(history))
+	}
+
+	reqs := srv.ChatRequests()
+	last := reqs[len(reqs)-1].Messages
+	var roles []string
+	for _, m := range last {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user" {
+		t.Fatalf("roles = %s, want each turn as its own message", got)
+	}
+	if last[1].Content != "첫 번째 질문" || last[3].Content != "두 번째 질문" {
+		t.Errorf("second request lacks conversation context: %+v", last)
+	}
+}
+
+func TestProcessMessageToolCall(t *testing.T) {
+	a, srv, tool := newTestAgent(t)
+
+	calls := 0
+	srv.SetChatFunc(func(req ollamatest.ChatRequest) string {
+		calls++
+		if calls == 1 {
+			return `@stub({"query": "날씨"})`
+		}
+		return "도구 결과를 확인했습니다."
+	})
+
+	got, err := a.ProcessMessage(context.Background(), "s1", "날씨 알려줘")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if got != "도구 결과를 확인했습니다." {
+		t.Errorf("response = %q", got)
+	}
+	if len(tool.calls) != 1 || tool.calls[0]["query"] != "날씨" {
+		t.Errorf("tool calls = %v", tool.calls)
+	}
+}
+
+func TestProcessMessageWithImages(t *testing.T) {
+	a, srv, _ := newTestAgent(t)
+
+	if _, err := a.ProcessMessageWithImages(context.Background(), "s1", "이게 뭐야?", []string{"aW1hZ2U="}); err != nil {
+		t.Fatalf("ProcessMessageWithImages: %v", err)
+	}
+
+	msgs := srv.ChatRequests()[0].Messages
+	if images := msgs[len(msgs)-1].Images; len(images) != 1 || images[0] != "aW1hZ2U=" {
+		t.Errorf("images = %v", images)
+	}
+	if history := a.GetSessionHistory("s1"); history[0].ImageCount != 1 {
+		t.Errorf("ImageCount = %d, want 1", history[0].ImageCount)
+	}
+}
+
+func TestProcessMessageToolAllowlist(t *testing.T) {
+	a, srv, tool := newTestAgent(t)
+	srv.SetModels("qwen2.5:0.5b", "other-model")
+	srv.SetChatReply(`@stub({"query": "날씨"})`)
+
+	opts := RunOptions{Model: "other-model", AllowedTools: []string{}}
+	if _, err := a.ProcessMessageWithOptions(context.Background(), "s1", "날씨 알려줘", opts); err != nil {
+		t.Fatalf("ProcessMessageWithOptions: %v", err)
+	}
+	if len(tool.calls) != 0 {
+		t.Errorf("disallowed tool was called: %v", tool.calls)
+	}
+	if reqs := srv.ChatRequests(); len(reqs) != 1 || reqs[0].Model != "other-model" {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestExpireSessions(t *testing.T) {
+	a, _, _ := newTestAgent(t)
+
+	a.GetOrCreateSession("kakao:old").UpdatedAt = time.Now().Add(-time.Hour)
+	a.GetOrCreateSession("kakao:new")
+	a.GetOrCreateSession("desktop").UpdatedAt = time.Now().Add(-time.Hour)
+
+	expired := a.ExpireSessions("kakao:", 30*time.Minute)
+	if len(expired) != 1 || expired[0] != "kakao:old" {
+		t.Errorf("expired = %v", expired)
+	}
+	if got := len(a.ListSessions()); got != 2 {
+		t.Errorf("%d sessions left, want 2", got)
+	}
+}
@@ -16,14 +16,66 @@ type Config struct {
 	OllamaURL   string `json:"ollamaUrl"`
 	OllamaModel string `json:"ollamaModel"`
 
+	// Remote Ollama authentication (bearer token takes precedence)
+	OllamaUsername    string `json:"ollamaUsername"`
+	OllamaPassword    string `json:"ollamaPassword"`
+	OllamaBearerToken string `json:"ollamaBearerToken"`
+
+	// Managed Ollama server environment
+	OllamaModelsDir       string `json:"ollamaModelsDir"`
+	OllamaHost            string `json:"ollamaHost"`
+	OllamaKeepAlive       string `json:"ollamaKeepAlive"`
+	OllamaNumParallel     int    `json:"ollamaNumParallel"`
+	OllamaMaxLoadedModels int    `json:"ollamaMaxLoadedModels"`
+
+	// Preload the default and Kakao models once Ollama is up
+	OllamaWarmup bool `json:"ollamaWarmup"`
+
+	// Ollama request scheduling
+	OllamaWorkers     int            `json:"ollamaWorkers"`
+	OllamaQueueLimits map[string]int `json:"ollamaQueueLimits"`
+
+	// Response cache
+	ResponseCacheEnabled    bool     `json:"responseCacheEnabled"`
+	ResponseCacheTTLMinutes int      `json:"responseCacheTtlMinutes"`
+	ResponseCacheMaxEntries int      `json:"responseCacheMaxEntries"`
+	ResponseCacheSources    []string `json:"responseCacheSources"`
+	ResponseCacheSemantic   bool     `json:"responseCacheSemantic"`
+	ResponseCacheThreshold  float64  `json:"responseCacheThreshold"`
+
 	// Kakao settings
-	KakaoEnabled     bool     `json:"kakaoEnabled"`
-	KakaoPort        int      `json:"kakaoPort"`
-	KakaoWebhookPath string   `json:"kakaoWebhookPath"`
-	KakaoDMPolicy    string   `json:"kakaoDmPolicy"`
-	KakaoAllowFrom   []string `json:"kakaoAllowFrom"`
-	KakaoSystemPrompt string  `json:"kakaoSystemPrompt"`
-	KakaoModel       string   `json:"kakaoModel"`
+	KakaoEnabled            bool           `json:"kakaoEnabled"`
+	KakaoPort               int            `json:"kakaoPort"`
+	KakaoWebhookPath        string         `json:"kakaoWebhookPath"`
+	KakaoDMPolicy           string         `json:"kakaoDmPolicy"`
+	KakaoAllowFrom          []string       `json:"kakaoAllowFrom"`
+	KakaoSystemPrompt       string         `json:"kakaoSystemPrompt"`
+	KakaoModel              string         `json:"kakaoModel"`
+	KakaoAllowedTools       []string       `json:"kakaoAllowedTools"`
+	KakaoSessionIdleMinutes int            `json:"kakaoSessionIdleMinutes"`
+	KakaoReplyTimeoutMs     int            `json:"kakaoReplyTimeoutMs"`
+	KakaoRichReplies        bool           `json:"kakaoRichReplies"`
+	KakaoAttachments        bool           `json:"kakaoAttachments"`
+	KakaoMaxAttachmentMB    int            `json:"kakaoMaxAttachmentMb"`
+	KakaoConversationLog    bool           `json:"kakaoConversationLog"`
+	KakaoLogRetentionDays   int            `json:"kakaoLogRetentionDays"`
+	KakaoWebhookSecret      string         `json:"kakaoWebhookSecret"`
+	KakaoAllowedIPs         []string       `json:"kakaoAllowedIps"`
+	KakaoTrustForwardedFor  bool           `json:"kakaoTrustForwardedFor"`
+	KakaoBotID              string         `json:"kakaoBotId"`
+	KakaoRateLimit          KakaoRateLimit `json:"kakaoRateLimit"`
+
+	// Kakao chat commands
+	KakaoAdmins             []string                `json:"kakaoAdmins"`
+	KakaoAllowedModels      []string                `json:"kakaoAllowedModels"`
+	KakaoProfiles           map[string]KakaoProfile `json:"kakaoProfiles"`
+	KakaoCommandPermissions map[string]string       `json:"kakaoCommandPermissions"`
+
+	// Further Kakao bots served on the same port
+	KakaoBots []KakaoBot `json:"kakaoBots"`
+
+	// Kakao Open Builder block routing
+	KakaoRoutes []KakaoRoute `json:"kakaoRoutes"`
 
 	// Relay settings
 	RelayURL   string `json:"relayUrl"`
@@ -34,6 +86,54 @@ type Config struct {
 	AccessToken  string `json:"accessToken"`
 }
 
+// KakaoRateLimit holds the Kakao bot's abuse limits; it mirrors
+// kakao.RateLimit
+type KakaoRateLimit struct {
+	Enabled              bool `json:"enabled"`
+	PerUserPerMinute     int  `json:"perUserPerMinute"`
+	PerUserBurst         int  `json:"perUserBurst"`
+	GlobalPerMinute      int  `json:"globalPerMinute"`
+	GlobalBurst          int  `json:"globalBurst"`
+	DailyQuota           int  `json:"dailyQuota"`
+	MaxUtteranceLength   int  `json:"maxUtteranceLength"`
+	BlockAfterViolations int  `json:"blockAfterViolations"`
+	BlockMinutes         int  `json:"blockMinutes"`
+}
+
+// KakaoProfile is a persona Kakao users can switch to; it mirrors
+// kakao.Profile
+type KakaoProfile struct {
+	SystemPrompt string   `json:"systemPrompt"`
+	Model        string   `json:"model,omitempty"`
+	AllowedTools []string `json:"allowedTools,omitempty"`
+}
+
+// KakaoBot is an additional Kakao bot with its own webhook path; empty
+// fields fall back to the main Kakao settings. It mirrors kakao.Bot.
+type KakaoBot struct {
+	Name         string          `json:"name"`
+	WebhookPath  string          `json:"webhookPath"`
+	BotID        string          `json:"botId,omitempty"`
+	DMPolicy     string          `json:"dmPolicy,omitempty"`
+	AllowFrom    []string        `json:"allowFrom,omitempty"`
+	SystemPrompt string          `json:"systemPrompt,omitempty"`
+	Model        string          `json:"model,omitempty"`
+	Profile      string          `json:"profile,omitempty"`
+	RateLimit    *KakaoRateLimit `json:"rateLimit,omitempty"`
+}
+
+// KakaoRoute sends an Open Builder block to a tool, prompt template or the
+// agent; it mirrors kakao.Route
+type KakaoRoute struct {
+	BlockID   string            `json:"blockId,omitempty"`
+	BlockName string            `json:"blockName,omitempty"`
+	Type      string            `json:"type"`
+	Tool      string            `json:"tool,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+	Prompt    string            `json:"prompt,omitempty"`
+	Profile   string            `json:"profile,omitempty"`
+}
+
 // DefaultConfig returns a new Config with default values
 func DefaultConfig() *Config {
 	return &Config{
@@ -41,6 +141,21 @@ func DefaultConfig() *Config {
 		Version:          "0.2.0",
 		OllamaURL:        "http://localhost:11434",
 		OllamaModel:      "qwen2.5:0.5b",
+		OllamaKeepAlive:  "30m",
+		OllamaWarmup:     true,
+		OllamaWorkers:    1,
+		OllamaQueueLimits: map[string]int{
+			"desktop": 4,
+			"kakao":   16,
+			"relay":   8,
+			"batch":   32,
+		},
+		ResponseCacheEnabled:    false,
+		ResponseCacheTTLMinutes: 60,
+		ResponseCacheMaxEntries: 500,
+		ResponseCacheSources:    []string{"kakao"},
+		ResponseCacheSemantic:   false,
+		ResponseCacheThreshold:  0.92,
 		KakaoEnabled:     true,
 		KakaoPort:        3847,
 		KakaoWebhookPath: "/kakao/webhook",
@@ -48,6 +163,32 @@ func DefaultConfig() *Config {
 		KakaoAllowFrom:   []string{},
 		KakaoSystemPrompt: "당신은 Dubai Crab, 한국 사무직을 위한 친절한 AI 비서입니다. 간결하고 도움이 되는 답변을 제공하세요.",
 		KakaoModel:       "qwen2.5:0.5b",
+		KakaoAllowedTools:       []string{},
+		KakaoSessionIdleMinutes: 30,
+		KakaoReplyTimeoutMs:     4500,
+		KakaoRichReplies:        true,
+		KakaoAttachments:        true,
+		KakaoMaxAttachmentMB:    10,
+		KakaoConversationLog:    true,
+		KakaoLogRetentionDays:   30,
+		KakaoRateLimit: KakaoRateLimit{
+			Enabled:              true,
+			PerUserPerMinute:     6,
+			PerUserBurst:         3,
+			GlobalPerMinute:      60,
+			GlobalBurst:          10,
+			DailyQuota:           200,
+			MaxUtteranceLength:   1000,
+			BlockAfterViolations: 5,
+			BlockMinutes:         10,
+		},
+		KakaoAdmins:             []string{},
+		KakaoAllowedModels:      []string{},
+		KakaoProfiles:           map[string]KakaoProfile{},
+		KakaoCommandPermissions: map[string]string{},
+		KakaoBots:               []KakaoBot{},
+		KakaoRoutes:             []KakaoRoute{},
+		KakaoAllowedIPs:         []string{},
 		RelayURL:         "wss://relay.dubaicrab.io",
 	}
 }
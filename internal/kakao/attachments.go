@@ -0,0 +1,286 @@
+package kakao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"DubaiCrab/internal/tools"
+)
+
+const (
+	defaultMaxAttachmentMB = 10
+	maxAttachments         = 3
+	maxAttachmentRunes     = 4000
+	attachmentTimeout      = 30 * time.Second
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s,()"'<>\[\]]+`)
+
+// attachmentTypes maps file extensions to how their text is extracted
+var attachmentTypes = map[string]string{
+	".png":  "image",
+	".jpg":  "image",
+	".jpeg": "image",
+	".gif":  "image",
+	".webp": "image",
+	".bmp":  "image",
+	".tiff": "image",
+	".tif":  "image",
+	".hwp":  "hwp",
+	".hwpx": "hwp",
+}
+
+// contentTypes maps MIME types to file extensions for URLs without one
+var contentTypes = map[string]string{
+	"image/png":                   ".png",
+	"image/jpeg":                  ".jpg",
+	"image/gif":                   ".gif",
+	"image/webp":                  ".webp",
+	"image/bmp":                   ".bmp",
+	"image/tiff":                  ".tiff",
+	"application/x-hwp":           ".hwp",
+	"application/haansofthwp":     ".hwp",
+	"application/vnd.hancom.hwp":  ".hwp",
+	"application/vnd.hancom.hwpx": ".hwpx",
+}
+
+// attachmentHosts are the domains attachments are downloaded from, with
+// their subdomains; Kakao serves files users send from its CDN
+var attachmentHosts = []string{"kakaocdn.net", "kakao.com"}
+
+// attachmentIPAllowed reports whether attachments may be downloaded from
+// ip. Internal addresses are refused so a crafted URL can't reach the local
+// machine or network; tests relax this for httptest servers.
+var attachmentIPAllowed = func(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast())
+}
+
+// allowedAttachmentHost reports whether host is one of attachmentHosts or
+// a subdomain of one
+func allowedAttachmentHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range attachmentHosts {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAttachmentClient returns the client attachments are downloaded with.
+// It only connects to allowed addresses, checked after DNS resolution, and
+// only follows redirects on the same host.
+func newAttachmentClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				if !attachmentIPAllowed(ip.IP) {
+					return nil, fmt.Errorf("허용되지 않은 주소입니다 (%s)", ip.IP)
+				}
+			}
+			if len(ips) == 0 {
+				return nil, fmt.Errorf("주소를 찾을 수 없습니다: %s", host)
+			}
+			// Dial the checked address so a second lookup can't swap it
+			return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+		},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: attachmentTimeout,
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("리다이렉트가 너무 많습니다")
+			}
+			if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+				return fmt.Errorf("다른 호스트로 리다이렉트할 수 없습니다: %s", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+}
+
+// ocrImage and parseDocument extract text from downloaded files; tests
+// replace them since tesseract and hwpparser are not always installed
+var (
+	ocrImage = func(ctx context.Context, path string) (string, error) {
+		return (&tools.OcrTool{}).Execute(ctx, map[string]interface{}{"path": path})
+	}
+	parseDocument = func(ctx context.Context, path string) (string, error) {
+		return (&tools.HWPParserTool{}).Execute(ctx, map[string]interface{}{"path": path})
+	}
+)
+
+// attachmentURLs returns the file URLs in a request that are on an allowed
+// host. URLs in action params (e.g. secureimage's secureUrls) are always
+// taken; URLs in the utterance only if they point at a supported file type.
+// Params are read in key order so the same request always picks the same
+// files.
+func attachmentURLs(utterance string, action *KakaoAction) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(u string) {
+		parsed, err := url.Parse(u)
+		if err != nil || !allowedAttachmentHost(parsed.Hostname()) {
+			return
+		}
+		if !seen[u] && len(urls) < maxAttachments {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+
+	if action != nil {
+		keys := make([]string, 0, len(action.Params))
+		for key := range action.Params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		detailKeys := make([]string, 0, len(action.DetailParams))
+		for key := range action.DetailParams {
+			detailKeys = append(detailKeys, key)
+		}
+		sort.Strings(detailKeys)
+
+		var values []string
+		for _, key := range keys {
+			values = append(values, action.Params[key])
+		}
+		for _, key := range detailKeys {
+			d := action.DetailParams[key]
+			values = append(values, d.Origin, d.Value)
+		}
+		for _, v := range values {
+			for _, u := range urlPattern.FindAllString(v, -1) {
+				add(u)
+			}
+		}
+	}
+
+	for _, u := range urlPattern.FindAllString(utterance, -1) {
+		if parsed, err := url.Parse(u); err == nil {
+			if _, ok := attachmentTypes[strings.ToLower(filepath.Ext(parsed.Path))]; ok {
+				add(u)
+			}
+		}
+	}
+	return urls
+}
+
+// withAttachments downloads the attachments, extracts their text and
+// prepends it to message. The downloaded files are removed afterwards.
+// Reading stops when ctx is done or the user sends /stop.
+func (s *Server) withAttachments(ctx context.Context, config *Config, senderID, message string, urls []string) string {
+	if len(urls) == 0 {
+		return message
+	}
+
+	dir, err := os.MkdirTemp("", "dubai-crab-kakao-")
+	if err != nil {
+		log.Printf("[kakao] Failed to create attachment dir: %v", err)
+		return message
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, attachmentTimeout)
+	defer cancel()
+	defer s.track(config.userKey(senderID), cancel)()
+
+	limit := int64(config.MaxAttachmentMB) * 1024 * 1024
+	if limit <= 0 {
+		limit = defaultMaxAttachmentMB * 1024 * 1024
+	}
+
+	var b strings.Builder
+	b.WriteString("사용자가 첨부한 파일의 내용입니다.\n")
+	for i, u := range urls {
+		text, err := s.readAttachment(ctx, dir, i, u, limit)
+		if err != nil {
+			log.Printf("[kakao] Attachment %s: %v", u, err)
+			fmt.Fprintf(&b, "\n[첨부 %d: 읽지 못함 - %v]\n", i+1, err)
+			continue
+		}
+		if r := []rune(text); len(r) > maxAttachmentRunes {
+			text = string(r[:maxAttachmentRunes]) + "\n(이하 생략)"
+		}
+		fmt.Fprintf(&b, "\n[첨부 %d]\n%s\n", i+1, strings.TrimSpace(text))
+	}
+	fmt.Fprintf(&b, "\n사용자 메시지: %s", message)
+	return b.String()
+}
+
+// readAttachment downloads one file into dir and extracts its text
+func (s *Server) readAttachment(ctx context.Context, dir string, index int, rawURL string, limit int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if (req.URL.Scheme != "https" && req.URL.Scheme != "http") || !allowedAttachmentHost(req.URL.Hostname()) {
+		return "", fmt.Errorf("허용되지 않은 주소입니다")
+	}
+	resp, err := s.files.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("다운로드 실패: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("다운로드 실패: HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > limit {
+		return "", fmt.Errorf("파일이 너무 큽니다 (%d바이트)", resp.ContentLength)
+	}
+
+	ext := strings.ToLower(filepath.Ext(req.URL.Path))
+	if _, ok := attachmentTypes[ext]; !ok {
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		ext = contentTypes[mediaType]
+	}
+	kind, ok := attachmentTypes[ext]
+	if !ok {
+		return "", fmt.Errorf("지원하지 않는 파일 형식입니다")
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("attachment-%d%s", index+1, ext))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, limit+1))
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("다운로드 실패: %w", err)
+	}
+	if n > limit {
+		return "", fmt.Errorf("파일이 너무 큽니다 (%dMB 초과)", limit/1024/1024)
+	}
+
+	if kind == "image" {
+		return ocrImage(ctx, path)
+	}
+	return parseDocument(ctx, path)
+}
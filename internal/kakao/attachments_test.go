@@ -0,0 +1,196 @@
+package kakao
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveFiles starts a file server and lets attachments be downloaded from
+// it even though it listens on a loopback address
+func serveFiles(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	files := httptest.NewServer(handler)
+	t.Cleanup(files.Close)
+
+	u, _ := url.Parse(files.URL)
+	origHosts, origIP := attachmentHosts, attachmentIPAllowed
+	attachmentHosts = append([]string{u.Hostname()}, origHosts...)
+	attachmentIPAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() { attachmentHosts, attachmentIPAllowed = origHosts, origIP })
+	return files
+}
+
+// fakeOCR replaces the OCR step and records the files it was given
+func fakeOCR(t *testing.T, text string) *[]string {
+	t.Helper()
+	var paths []string
+	orig := ocrImage
+	ocrImage = func(ctx context.Context, path string) (string, error) {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("attachment not downloaded: %v", err)
+		}
+		paths = append(paths, path)
+		return text, nil
+	}
+	t.Cleanup(func() { ocrImage = orig })
+	return &paths
+}
+
+func TestAttachmentURLs(t *testing.T) {
+	action := &KakaoAction{Params: map[string]string{
+		"secureimage": `{"privacyAgreement":"Y","imageQuantity":"2","secureUrls":"List(https://talk.kakaocdn.net/a, https://talk.kakaocdn.net/b)"}`,
+	}}
+	got := attachmentURLs("영수증 https://k.kakaocdn.net/page https://k.kakaocdn.net/scan.PNG https://example.com/scan.png", action)
+	want := []string{"https://talk.kakaocdn.net/a", "https://talk.kakaocdn.net/b", "https://k.kakaocdn.net/scan.PNG"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("urls = %v, want %v", got, want)
+	}
+}
+
+func TestAttachmentURLsStableOrder(t *testing.T) {
+	action := &KakaoAction{Params: map[string]string{}}
+	for _, key := range []string{"e", "d", "c", "b", "a"} {
+		action.Params[key] = "https://talk.kakaocdn.net/" + key
+	}
+	for i := 0; i < 20; i++ {
+		if got := strings.Join(attachmentURLs("", action), " "); got != "https://talk.kakaocdn.net/a https://talk.kakaocdn.net/b https://talk.kakaocdn.net/c" {
+			t.Fatalf("urls = %s", got)
+		}
+	}
+}
+
+func TestAttachmentRefusesInternalAddresses(t *testing.T) {
+	var hits int
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png bytes"))
+	}))
+	defer files.Close()
+
+	// Even an allowed host name may not resolve to a loopback address
+	u, _ := url.Parse(files.URL)
+	orig := attachmentHosts
+	attachmentHosts = []string{u.Hostname()}
+	defer func() { attachmentHosts = orig }()
+
+	s, _ := newTestServer(t)
+	if _, err := s.readAttachment(context.Background(), t.TempDir(), 0, files.URL+"/a.png", 1<<20); err == nil {
+		t.Error("downloaded from a loopback address")
+	}
+	if _, err := s.readAttachment(context.Background(), t.TempDir(), 0, "https://example.com/a.png", 1<<20); err == nil {
+		t.Error("downloaded from a host outside the allowlist")
+	}
+	if hits != 0 {
+		t.Errorf("file server was hit %d times", hits)
+	}
+}
+
+func TestAttachmentRefusesCrossHostRedirect(t *testing.T) {
+	fakeOCR(t, "unused")
+	files := serveFiles(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:1/secret.png", http.StatusFound)
+	})
+
+	s, _ := newTestServer(t)
+	_, err := s.readAttachment(context.Background(), t.TempDir(), 0, files.URL+"/a.png", 1<<20)
+	if err == nil || !strings.Contains(err.Error(), "리다이렉트") {
+		t.Errorf("err = %v, want a redirect error", err)
+	}
+}
+
+func TestWebhookAttachmentOCR(t *testing.T) {
+	files := serveFiles(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg bytes"))
+	})
+
+	paths := fakeOCR(t, "합계 12,000원")
+	s, srv := newTestServer(t)
+	srv.SetChatReply("12,000원입니다")
+
+	req := userRequest("u1", "이 영수증 얼마야?")
+	req.Action = &KakaoAction{Params: map[string]string{
+		"secureimage": `{"secureUrls":"List(` + files.URL + `/receipt)"}`,
+	}}
+	postWebhook(t, s, "/kakao/webhook", req, nil)
+
+	if len(*paths) != 1 || !strings.HasSuffix((*paths)[0], ".jpg") {
+		t.Fatalf("ocr paths = %v", *paths)
+	}
+	if _, err := os.Stat((*paths)[0]); !os.IsNotExist(err) {
+		t.Errorf("temp file not cleaned up: %v", err)
+	}
+
+	msgs := srv.ChatRequests()[0].Messages
+	last := msgs[len(msgs)-1].Content
+	if !strings.Contains(last, "합계 12,000원") || !strings.Contains(last, "이 영수증 얼마야?") {
+		t.Errorf("prompt missing attachment text: %q", last)
+	}
+}
+
+func TestAttachmentTooLarge(t *testing.T) {
+	files := serveFiles(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2*1024*1024))
+	})
+
+	paths := fakeOCR(t, "unused")
+	s, srv := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.MaxAttachmentMB = 1
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", files.URL+"/big.png"), nil)
+
+	if len(*paths) != 0 {
+		t.Errorf("oversized file was processed: %v", *paths)
+	}
+	msgs := srv.ChatRequests()[0].Messages
+	if last := msgs[len(msgs)-1].Content; !strings.Contains(last, "너무 큽니다") {
+		t.Errorf("prompt = %q", last)
+	}
+}
+
+func TestStopCancelsAttachmentOCR(t *testing.T) {
+	files := serveFiles(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png bytes"))
+	})
+
+	started := make(chan struct{})
+	orig := ocrImage
+	ocrImage = func(ctx context.Context, path string) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	t.Cleanup(func() { ocrImage = orig })
+
+	s, _ := newTestServer(t)
+	config := s.GetConfig()
+	done := make(chan string, 1)
+	go func() {
+		done <- s.withAttachments(context.Background(), config, "u1", "읽어줘", []string{files.URL + "/a.png"})
+	}()
+
+	<-started
+	if got := s.runCommand(config, "u1", "/stop"); got != "답변 생성을 중단했습니다." {
+		t.Errorf("stop = %q", got)
+	}
+	select {
+	case text := <-done:
+		if !strings.Contains(text, "읽지 못함") {
+			t.Errorf("text = %q", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OCR was not cancelled by /stop")
+	}
+}
@@ -0,0 +1,130 @@
+package kakao
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecretHeader carries the shared webhook secret, set as a custom header in
+// the Open Builder skill settings. The secret may also be passed as the
+// "token" query parameter of the skill URL.
+const SecretHeader = "X-Webhook-Secret"
+
+// auditLogMaxBytes caps the audit log; older entries are rotated out so a
+// flood of rejected requests can't fill the disk
+const auditLogMaxBytes = 1 << 20
+
+// AuditEntry is a rejected webhook request
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Reason     string    `json:"reason"`
+	BotID      string    `json:"botId,omitempty"`
+	UserID     string    `json:"userId,omitempty"`
+}
+
+// clientIP returns the address the request came from, using the first
+// X-Forwarded-For entry when the server is behind a trusted proxy or tunnel
+func clientIP(r *http.Request, trustForwarded bool) string {
+	if trustForwarded {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ipAllowed reports whether ip matches one of the allowed IPs or CIDR ranges
+func ipAllowed(ip string, allowed []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTransport checks the shared secret and source IP of a webhook
+// request, returning why it was rejected or "" if it passes
+func verifyTransport(r *http.Request, config *Config) string {
+	if config.WebhookSecret != "" {
+		secret := r.Header.Get(SecretHeader)
+		if secret == "" {
+			secret = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(config.WebhookSecret)) != 1 {
+			return "invalid secret"
+		}
+	}
+
+	if len(config.AllowedIPs) > 0 && !ipAllowed(clientIP(r, config.TrustForwardedFor), config.AllowedIPs) {
+		return "ip not allowed"
+	}
+	return ""
+}
+
+// verifyBot checks the request against the pinned bot ID
+func verifyBot(req *KakaoRequest, config *Config) string {
+	if config.BotID == "" {
+		return ""
+	}
+	if req.Bot == nil || req.Bot.ID != config.BotID {
+		return "bot id mismatch"
+	}
+	return ""
+}
+
+// reject records a rejected request in the audit log and answers 403
+func (s *Server) reject(w http.ResponseWriter, r *http.Request, config *Config, req *KakaoRequest, reason string) {
+	entry := AuditEntry{
+		Time:       time.Now(),
+		RemoteAddr: clientIP(r, config.TrustForwardedFor),
+		Reason:     reason,
+	}
+	if req != nil {
+		if req.Bot != nil {
+			entry.BotID = req.Bot.ID
+		}
+		if req.UserRequest != nil && req.UserRequest.User != nil {
+			entry.UserID = req.UserRequest.User.ID
+		}
+	}
+
+	log.Printf("[kakao] Rejected request from %s: %s", entry.RemoteAddr, reason)
+	if err := s.audit.append(entry); err != nil {
+		log.Printf("[kakao] Failed to write audit log: %v", err)
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// AuditLog returns up to limit of the most recent rejected requests, newest
+// first; limit <= 0 returns all that are kept
+func (s *Server) AuditLog(limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	err := s.audit.tail(limit, func(line []byte) error {
+		var entry AuditEntry
+		if json.Unmarshal(line, &entry) == nil {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
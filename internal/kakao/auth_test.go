@@ -0,0 +1,106 @@
+package kakao
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebhookSecret(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cfg := DefaultConfig()
+	cfg.WebhookSecret = "s3cret"
+	s.UpdateConfig(cfg)
+
+	req := userRequest("u1", "안녕")
+	if code, _ := postWebhook(t, s, "/kakao/webhook", req, nil); code != http.StatusForbidden {
+		t.Errorf("no secret: status %d", code)
+	}
+	if code, _ := postWebhook(t, s, "/kakao/webhook", req, http.Header{SecretHeader: {"wrong"}}); code != http.StatusForbidden {
+		t.Errorf("wrong secret: status %d", code)
+	}
+	if code, _ := postWebhook(t, s, "/kakao/webhook", req, http.Header{SecretHeader: {"s3cret"}}); code != http.StatusOK {
+		t.Errorf("header secret: status %d", code)
+	}
+	if code, _ := postWebhook(t, s, "/kakao/webhook?token=s3cret", req, nil); code != http.StatusOK {
+		t.Errorf("query token: status %d", code)
+	}
+
+	entries, err := s.AuditLog(0)
+	if err != nil || len(entries) != 2 || entries[0].Reason != "invalid secret" {
+		t.Errorf("audit log = %+v, %v", entries, err)
+	}
+}
+
+func TestWebhookIPAllowlist(t *testing.T) {
+	s, _ := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.AllowedIPs = []string{"10.0.0.0/8", "192.0.2.7"}
+	s.UpdateConfig(cfg)
+
+	// httptest requests come from 192.0.2.1
+	if code, _ := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil); code != http.StatusForbidden {
+		t.Errorf("outside allowlist: status %d", code)
+	}
+
+	cfg.TrustForwardedFor = true
+	s.UpdateConfig(cfg)
+	header := http.Header{"X-Forwarded-For": {"10.1.2.3, 127.0.0.1"}}
+	if code, _ := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), header); code != http.StatusOK {
+		t.Errorf("forwarded from allowed range: status %d", code)
+	}
+}
+
+func TestWebhookBotPinning(t *testing.T) {
+	s, _ := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.BotID = "bot-1"
+	s.UpdateConfig(cfg)
+
+	req := userRequest("u1", "안녕")
+	if code, _ := postWebhook(t, s, "/kakao/webhook", req, nil); code != http.StatusForbidden {
+		t.Errorf("missing bot: status %d", code)
+	}
+	req.Bot = &KakaoBot{ID: "bot-1"}
+	if code, _ := postWebhook(t, s, "/kakao/webhook", req, nil); code != http.StatusOK {
+		t.Errorf("pinned bot: status %d", code)
+	}
+}
+
+func TestAuditLogRotatesAndReadsTail(t *testing.T) {
+	dir := t.TempDir()
+	l := jsonlLog{maxBytes: 4096}
+	l.setPath(filepath.Join(dir, "audit.jsonl"))
+
+	for i := 0; i < 200; i++ {
+		l.append(AuditEntry{RemoteAddr: fmt.Sprintf("10.0.0.%d", i), Reason: "invalid secret"})
+	}
+	if info, err := os.Stat(filepath.Join(dir, "audit.jsonl")); err != nil || info.Size() > 4096 {
+		t.Fatalf("log not capped: %v, %v", info, err)
+	}
+
+	var got []string
+	l.tail(3, func(line []byte) error {
+		var entry AuditEntry
+		json.Unmarshal(line, &entry)
+		got = append(got, entry.RemoteAddr)
+		return nil
+	})
+	if len(got) != 3 || got[0] != "10.0.0.199" || got[2] != "10.0.0.197" {
+		t.Errorf("tail = %v", got)
+	}
+
+	// Reading everything continues into the rotated file, newest first
+	var all []string
+	l.tail(0, func(line []byte) error {
+		all = append(all, string(line))
+		return nil
+	})
+	if len(all) <= len(got) || len(all) >= 200 {
+		t.Errorf("read %d entries across both files", len(all))
+	}
+}
@@ -0,0 +1,149 @@
+package kakao
+
+import (
+	"sync"
+	"time"
+)
+
+// mainBot names the bot described by the top-level configuration
+const mainBot = "main"
+
+// Bot is an additional Open Builder bot served on the same listener under
+// its own webhook path. Empty fields fall back to the main configuration.
+type Bot struct {
+	Name         string     `json:"name"`
+	WebhookPath  string     `json:"webhookPath"`
+	BotID        string     `json:"botId,omitempty"`
+	DMPolicy     string     `json:"dmPolicy,omitempty"`
+	AllowFrom    []string   `json:"allowFrom,omitempty"`
+	SystemPrompt string     `json:"systemPrompt,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	Profile      string     `json:"profile,omitempty"` // applied before the user's /profile choice
+	RateLimit    *RateLimit `json:"rateLimit,omitempty"`
+}
+
+// BotStatus is the state of one bot
+type BotStatus struct {
+	Name        string    `json:"name"`
+	WebhookPath string    `json:"webhookPath"`
+	BotID       string    `json:"botId,omitempty"`
+	DMPolicy    string    `json:"dmPolicy"`
+	Model       string    `json:"model"`
+	Requests    int       `json:"requests"` // since the app started
+	LastRequest time.Time `json:"lastRequest,omitempty"`
+}
+
+// forBot returns the configuration the given bot runs with
+func (c *Config) forBot(b Bot) *Config {
+	cfg := *c
+	cfg.bot = b.Name
+	cfg.Bots = nil
+	cfg.WebhookPath = b.WebhookPath
+
+	if profile, ok := c.Profiles[b.Profile]; ok {
+		over := profile.over(Profile{SystemPrompt: cfg.SystemPrompt, Model: cfg.Model, AllowedTools: cfg.AllowedTools})
+		cfg.SystemPrompt, cfg.Model, cfg.AllowedTools = over.SystemPrompt, over.Model, over.AllowedTools
+	}
+	if b.BotID != "" {
+		cfg.BotID = b.BotID
+	}
+	if b.DMPolicy != "" {
+		cfg.DMPolicy = b.DMPolicy
+	}
+	if b.AllowFrom != nil {
+		cfg.AllowFrom = b.AllowFrom
+	}
+	if b.SystemPrompt != "" {
+		cfg.SystemPrompt = b.SystemPrompt
+	}
+	if b.Model != "" {
+		cfg.Model = b.Model
+	}
+	if b.RateLimit != nil {
+		cfg.RateLimit = *b.RateLimit
+	}
+	return &cfg
+}
+
+// botFor returns the configuration of the bot serving path
+func (c *Config) botFor(path string) (*Config, bool) {
+	if path == c.WebhookPath {
+		cfg := *c
+		cfg.bot = mainBot
+		return &cfg, true
+	}
+	for _, b := range c.Bots {
+		if b.WebhookPath == path {
+			return c.forBot(b), true
+		}
+	}
+	return nil, false
+}
+
+// botState keeps the rate limits and request counts of each bot
+type botState struct {
+	mu     sync.Mutex
+	limits map[string]*rateLimiter
+	stats  map[string]*BotStatus
+}
+
+func (b *botState) limiter(name string) *rateLimiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limits == nil {
+		b.limits = make(map[string]*rateLimiter)
+	}
+	l, ok := b.limits[name]
+	if !ok {
+		l = &rateLimiter{}
+		b.limits[name] = l
+	}
+	return l
+}
+
+func (b *botState) record(name string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stats == nil {
+		b.stats = make(map[string]*BotStatus)
+	}
+	st, ok := b.stats[name]
+	if !ok {
+		st = &BotStatus{}
+		b.stats[name] = st
+	}
+	st.Requests++
+	st.LastRequest = now
+}
+
+func (b *botState) prune(now time.Time) {
+	b.mu.Lock()
+	limits := make([]*rateLimiter, 0, len(b.limits))
+	for _, l := range b.limits {
+		limits = append(limits, l)
+	}
+	b.mu.Unlock()
+
+	for _, l := range limits {
+		l.prune(now)
+	}
+}
+
+// status fills in the counters for a bot's configuration
+func (b *botState) status(cfg *Config) BotStatus {
+	st := BotStatus{
+		Name:        cfg.bot,
+		WebhookPath: cfg.WebhookPath,
+		BotID:       cfg.BotID,
+		DMPolicy:    cfg.DMPolicy,
+		Model:       cfg.Model,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if counts, ok := b.stats[cfg.bot]; ok {
+		st.Requests = counts.Requests
+		st.LastRequest = counts.LastRequest
+	}
+	return st
+}
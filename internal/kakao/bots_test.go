@@ -0,0 +1,113 @@
+package kakao
+
+import (
+	"net/http"
+	"testing"
+)
+
+func twoBotConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.SystemPrompt = "총무팀 비서"
+	cfg.Bots = []Bot{{
+		Name:         "sales",
+		WebhookPath:  "/kakao/sales",
+		SystemPrompt: "영업팀 비서",
+		DMPolicy:     "allowlist",
+		AllowFrom:    []string{"s1"},
+	}}
+	return cfg
+}
+
+func TestBotsUseOwnSettings(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	s.UpdateConfig(twoBotConfig())
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	postWebhook(t, s, "/kakao/sales", userRequest("s1", "안녕"), nil)
+
+	reqs := srv.ChatRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("chat requests = %d", len(reqs))
+	}
+	for i, want := range []string{"총무팀 비서", "영업팀 비서"} {
+		if got := reqs[i].Messages[0].Content; len(got) < len(want) || got[:len(want)] != want {
+			t.Errorf("bot %d system prompt = %q, want %q", i, got, want)
+		}
+	}
+
+	_, resp := postWebhook(t, s, "/kakao/sales", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "접근이 허용되지 않았습니다." {
+		t.Errorf("sales bot allowlist not applied: %q", got)
+	}
+}
+
+func TestBotUnknownPath(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.UpdateConfig(twoBotConfig())
+
+	if code, _ := postWebhook(t, s, "/kakao/other", userRequest("u1", "안녕"), nil); code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", code)
+	}
+}
+
+func TestBotRateLimitsAndStatus(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	cfg := twoBotConfig()
+	strict := DefaultRateLimit()
+	strict.PerUserBurst = 1
+	cfg.Bots[0].RateLimit = &strict
+	cfg.Bots[0].DMPolicy = "open"
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/sales", userRequest("u1", "하나"), nil)
+	_, resp := postWebhook(t, s, "/kakao/sales", userRequest("u1", "둘"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != limitUserRate.message(strict) {
+		t.Errorf("sales bot not limited: %q", got)
+	}
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "셋"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "네" {
+		t.Errorf("main bot limited by sales bot: %q", got)
+	}
+
+	status := s.GetStatus()
+	if len(status.Bots) != 2 {
+		t.Fatalf("bots = %+v", status.Bots)
+	}
+	if b := status.Bots[0]; b.Name != mainBot || b.Requests != 1 {
+		t.Errorf("main status = %+v", b)
+	}
+	if b := status.Bots[1]; b.Name != "sales" || b.Requests != 2 || b.WebhookPath != "/kakao/sales" {
+		t.Errorf("sales status = %+v", b)
+	}
+}
+
+func TestBotsKeepSeparateConversations(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	cfg := twoBotConfig()
+	cfg.Bots[0].DMPolicy = "open"
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "총무 질문"), nil)
+	postWebhook(t, s, "/kakao/sales", userRequest("u1", "영업 질문"), nil)
+
+	reqs := srv.ChatRequests()
+	for _, m := range reqs[len(reqs)-1].Messages {
+		if m.Content == "총무 질문" {
+			t.Errorf("main bot history leaked into the sales bot: %+v", reqs[len(reqs)-1].Messages)
+		}
+	}
+
+	s.TakeOver("sales", "u1")
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "네" {
+		t.Errorf("main bot reply while sales is taken over = %q", got)
+	}
+	_, resp = postWebhook(t, s, "/kakao/sales", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != takeoverText {
+		t.Errorf("sales bot reply = %q, want the takeover text", got)
+	}
+}
@@ -0,0 +1,142 @@
+package kakao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// callbackWindow is how long a Kakao callback URL stays valid after the
+// skill request
+const callbackWindow = time.Minute
+
+// callbackBackoff is the delay before the first retry; it doubles after
+// each failed attempt
+var callbackBackoff = 500 * time.Millisecond
+
+// DeadLetter is a callback response that could not be delivered
+type DeadLetter struct {
+	Time        time.Time       `json:"time"`
+	SenderID    string          `json:"senderId"`
+	CallbackURL string          `json:"callbackUrl"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error"`
+	Response    json.RawMessage `json:"response"`
+}
+
+// callbackError is a failed delivery attempt
+type callbackError struct {
+	err       error
+	retryable bool
+}
+
+func (e *callbackError) Error() string { return e.err.Error() }
+func (e *callbackError) Unwrap() error { return e.err }
+
+// callbackResult is the body Kakao returns from a callback URL
+type callbackResult struct {
+	TaskID  string `json:"taskId"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// deliverCallback posts response to callbackURL, retrying with exponential
+// backoff until the callback window that opened at received closes.
+// Responses that can't be delivered go to the dead-letter log.
+func (s *Server) deliverCallback(callbackURL, senderID string, received time.Time, response *KakaoResponse) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("[kakao] Failed to encode callback: %v", err)
+		return
+	}
+
+	deadline := received.Add(callbackWindow)
+	backoff := callbackBackoff
+	attempts := 0
+	for {
+		attempts++
+		err = s.postCallback(callbackURL, body, deadline)
+		if err == nil {
+			return
+		}
+
+		var cbErr *callbackError
+		retryable := errors.As(err, &cbErr) && cbErr.retryable
+		if !retryable || time.Now().Add(backoff).After(deadline) {
+			break
+		}
+
+		log.Printf("[kakao] Callback attempt %d failed, retrying in %v: %v", attempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	log.Printf("[kakao] Callback to %s failed after %d attempts: %v", senderID, attempts, err)
+	letter := DeadLetter{
+		Time:        time.Now(),
+		SenderID:    senderID,
+		CallbackURL: callbackURL,
+		Attempts:    attempts,
+		Error:       err.Error(),
+		Response:    body,
+	}
+	if err := s.deadLetters.append(letter); err != nil {
+		log.Printf("[kakao] Failed to record dead letter: %v", err)
+	}
+}
+
+// postCallback makes one delivery attempt
+func (s *Server) postCallback(callbackURL string, body []byte, deadline time.Time) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return &callbackError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &callbackError{err: err, retryable: ctx.Err() == nil}
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &callbackError{
+			err:       fmt.Errorf("callback returned status %d: %s", resp.StatusCode, bytes.TrimSpace(data)),
+			retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		}
+	}
+
+	var result callbackResult
+	if json.Unmarshal(data, &result) == nil && result.Status == "FAIL" {
+		return &callbackError{err: fmt.Errorf("callback rejected: %s", result.Message)}
+	}
+	return nil
+}
+
+// DeadLetters returns the undelivered callback responses, oldest first
+func (s *Server) DeadLetters() ([]DeadLetter, error) {
+	letters := []DeadLetter{}
+	err := s.deadLetters.read(func(line []byte) error {
+		var letter DeadLetter
+		if json.Unmarshal(line, &letter) == nil {
+			letters = append(letters, letter)
+		}
+		return nil
+	})
+	return letters, err
+}
+
+// ClearDeadLetters deletes the dead-letter log
+func (s *Server) ClearDeadLetters() error {
+	return s.deadLetters.clear()
+}
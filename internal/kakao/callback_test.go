@@ -0,0 +1,92 @@
+package kakao
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCallbackServer(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		status := http.StatusOK
+		if int(n) <= len(statuses) {
+			status = statuses[n-1]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"taskId":"t1","status":"SUCCESS"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func fastBackoff(t *testing.T) {
+	t.Helper()
+	old := callbackBackoff
+	callbackBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { callbackBackoff = old })
+}
+
+func TestCallbackRetriesTransientErrors(t *testing.T) {
+	fastBackoff(t)
+	s, _ := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cb, calls := newCallbackServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	s.deliverCallback(cb.URL, "u1", time.Now(), NewSimpleTextResponse("답변"))
+
+	if n := atomic.LoadInt32(calls); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	if letters, _ := s.DeadLetters(); len(letters) != 0 {
+		t.Errorf("delivered callback was dead-lettered: %+v", letters)
+	}
+}
+
+func TestCallbackPermanentErrorDeadLetters(t *testing.T) {
+	fastBackoff(t)
+	s, _ := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cb, calls := newCallbackServer(t, http.StatusBadRequest)
+
+	s.deliverCallback(cb.URL, "u1", time.Now(), NewSimpleTextResponse("답변"))
+
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+	letters, err := s.DeadLetters()
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("dead letters = %+v, %v", letters, err)
+	}
+	if letters[0].SenderID != "u1" || letters[0].Attempts != 1 {
+		t.Errorf("dead letter = %+v", letters[0])
+	}
+
+	if err := s.ClearDeadLetters(); err != nil {
+		t.Fatal(err)
+	}
+	if letters, _ := s.DeadLetters(); len(letters) != 0 {
+		t.Errorf("%d dead letters after clear", len(letters))
+	}
+}
+
+func TestCallbackStopsAtWindow(t *testing.T) {
+	fastBackoff(t)
+	s, _ := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cb, calls := newCallbackServer(t, 500, 500, 500, 500, 500, 500, 500, 500, 500, 500)
+
+	// The window opened almost a minute ago, leaving room for one attempt
+	s.deliverCallback(cb.URL, "u1", time.Now().Add(-callbackWindow+5*time.Millisecond), NewSimpleTextResponse("답변"))
+
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+	if letters, _ := s.DeadLetters(); len(letters) != 1 {
+		t.Errorf("%d dead letters, want 1", len(letters))
+	}
+}
@@ -0,0 +1,313 @@
+package kakao
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Command permissions
+const (
+	PermissionEveryone = "everyone"
+	PermissionAdmin    = "admin"
+	PermissionDisabled = "disabled"
+)
+
+// Profile is a named bot persona users can switch to with /profile
+type Profile struct {
+	SystemPrompt string   `json:"systemPrompt"`
+	Model        string   `json:"model,omitempty"`
+	AllowedTools []string `json:"allowedTools,omitempty"`
+}
+
+// over returns base with the fields the profile sets replaced
+func (p Profile) over(base Profile) Profile {
+	if p.SystemPrompt != "" {
+		base.SystemPrompt = p.SystemPrompt
+	}
+	if p.Model != "" {
+		base.Model = p.Model
+	}
+	if p.AllowedTools != nil {
+		base.AllowedTools = p.AllowedTools
+	}
+	return base
+}
+
+// CommandContext is passed to command handlers
+type CommandContext struct {
+	SenderID string
+	Args     string
+	Config   *Config
+}
+
+// CommandHandler runs a command and returns the reply
+type CommandHandler func(ctx CommandContext) string
+
+// Command is a chat command starting with "/" that is handled without
+// calling the LLM
+type Command struct {
+	Name        string // without the leading "/"
+	Usage       string
+	Description string
+	// Permission is the default permission; Config.CommandPermissions
+	// overrides it per command
+	Permission string
+	Handler    CommandHandler
+}
+
+// userPrefs are the per-user choices made with /model and /profile
+type userPrefs struct {
+	Model   string
+	Profile string
+}
+
+// commandState holds registered commands and per-user state they manage
+type commandState struct {
+	mu       sync.RWMutex
+	commands map[string]Command
+	prefs    map[string]userPrefs
+	inflight map[string]*inflightCall
+}
+
+// inflightCall is an answer being generated, cancelled by /stop
+type inflightCall struct {
+	cancel context.CancelFunc
+}
+
+// RegisterCommand adds or replaces a chat command
+func (s *Server) RegisterCommand(cmd Command) {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+
+	if s.commands.commands == nil {
+		s.commands.commands = make(map[string]Command)
+	}
+	if cmd.Permission == "" {
+		cmd.Permission = PermissionEveryone
+	}
+	s.commands.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// registerBuiltinCommands registers the default commands
+func (s *Server) registerBuiltinCommands() {
+	s.RegisterCommand(Command{Name: "help", Usage: "/help", Description: "명령어 목록", Handler: s.cmdHelp})
+	s.RegisterCommand(Command{Name: "reset", Usage: "/reset", Description: "대화 내용 초기화", Handler: s.cmdReset})
+	s.RegisterCommand(Command{Name: "model", Usage: "/model <이름>", Description: "모델 변경", Handler: s.cmdModel})
+	s.RegisterCommand(Command{Name: "profile", Usage: "/profile <이름>", Description: "프로필 변경", Handler: s.cmdProfile})
+	s.RegisterCommand(Command{Name: "usage", Usage: "/usage", Description: "오늘 사용량", Handler: s.cmdUsage})
+	s.RegisterCommand(Command{Name: "stop", Usage: "/stop", Description: "진행 중인 답변 중단", Handler: s.cmdStop})
+}
+
+// permission returns the effective permission of a command
+func permission(cmd Command, config *Config) string {
+	if p, ok := config.CommandPermissions[cmd.Name]; ok && p != "" {
+		return p
+	}
+	return cmd.Permission
+}
+
+// isAdmin reports whether senderID is a bot admin
+func isAdmin(config *Config, senderID string) bool {
+	for _, id := range config.Admins {
+		if strings.EqualFold(id, senderID) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayRun reports whether senderID may run cmd
+func mayRun(cmd Command, config *Config, senderID string) bool {
+	switch permission(cmd, config) {
+	case PermissionDisabled:
+		return false
+	case PermissionAdmin:
+		return isAdmin(config, senderID)
+	default:
+		return true
+	}
+}
+
+// runCommand handles a message starting with "/"
+func (s *Server) runCommand(config *Config, senderID, message string) string {
+	name, args, _ := strings.Cut(strings.TrimPrefix(message, "/"), " ")
+	name = strings.ToLower(name)
+
+	s.commands.mu.RLock()
+	cmd, ok := s.commands.commands[name]
+	s.commands.mu.RUnlock()
+
+	if !ok || permission(cmd, config) == PermissionDisabled {
+		return "알 수 없는 명령어입니다. /help 로 사용 가능한 명령어를 확인하세요."
+	}
+	if !mayRun(cmd, config, senderID) {
+		return "이 명령어를 사용할 권한이 없습니다."
+	}
+
+	return cmd.Handler(CommandContext{
+		SenderID: senderID,
+		Args:     strings.TrimSpace(args),
+		Config:   config,
+	})
+}
+
+func (s *Server) cmdHelp(ctx CommandContext) string {
+	s.commands.mu.RLock()
+	var cmds []Command
+	for _, cmd := range s.commands.commands {
+		if mayRun(cmd, ctx.Config, ctx.SenderID) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	s.commands.mu.RUnlock()
+
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	lines := []string{"사용 가능한 명령어:"}
+	for _, cmd := range cmds {
+		lines = append(lines, fmt.Sprintf("%s - %s", cmd.Usage, cmd.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *Server) cmdReset(ctx CommandContext) string {
+	key := ctx.Config.userKey(ctx.SenderID)
+	s.agent.ClearSession(sessionID(key))
+	s.pages.set(key, nil)
+	s.late.drop(key)
+	return "대화 내용을 초기화했습니다."
+}
+
+func (s *Server) cmdModel(ctx CommandContext) string {
+	allowed := ctx.Config.AllowedModels
+	if len(allowed) == 0 {
+		return "변경할 수 있는 모델이 없습니다."
+	}
+
+	if ctx.Args == "" {
+		current, _ := s.resolve(ctx.Config, ctx.SenderID)
+		return fmt.Sprintf("현재 모델: %s\n사용 가능: %s", current.Model, strings.Join(allowed, ", "))
+	}
+	for _, m := range allowed {
+		if m == ctx.Args {
+			s.setPrefs(ctx.Config.userKey(ctx.SenderID), func(p *userPrefs) { p.Model = m })
+			return fmt.Sprintf("모델을 %s(으)로 변경했습니다.", m)
+		}
+	}
+	return fmt.Sprintf("사용할 수 없는 모델입니다. 사용 가능: %s", strings.Join(allowed, ", "))
+}
+
+func (s *Server) cmdProfile(ctx CommandContext) string {
+	var names []string
+	for name := range ctx.Config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "등록된 프로필이 없습니다."
+	}
+
+	if ctx.Args == "" {
+		_, current := s.resolve(ctx.Config, ctx.SenderID)
+		if current == "" {
+			current = "기본"
+		}
+		return fmt.Sprintf("현재 프로필: %s\n사용 가능: %s", current, strings.Join(names, ", "))
+	}
+	if ctx.Args == "기본" || ctx.Args == "default" {
+		s.setPrefs(ctx.Config.userKey(ctx.SenderID), func(p *userPrefs) { p.Profile = "" })
+		return "기본 프로필로 돌아왔습니다."
+	}
+	if _, ok := ctx.Config.Profiles[ctx.Args]; !ok {
+		return fmt.Sprintf("없는 프로필입니다. 사용 가능: %s", strings.Join(names, ", "))
+	}
+	s.setPrefs(ctx.Config.userKey(ctx.SenderID), func(p *userPrefs) { p.Profile = ctx.Args })
+	return fmt.Sprintf("프로필을 %s(으)로 변경했습니다.", ctx.Args)
+}
+
+func (s *Server) cmdUsage(ctx CommandContext) string {
+	count := s.bots.limiter(ctx.Config.bot).todayCount(ctx.SenderID)
+	if quota := ctx.Config.RateLimit.DailyQuota; ctx.Config.RateLimit.Enabled && quota > 0 {
+		return fmt.Sprintf("오늘 보낸 메시지: %d / %d", count, quota)
+	}
+	return fmt.Sprintf("오늘 보낸 메시지: %d", count)
+}
+
+func (s *Server) cmdStop(ctx CommandContext) string {
+	key := ctx.Config.userKey(ctx.SenderID)
+	s.commands.mu.Lock()
+	call, ok := s.commands.inflight[key]
+	delete(s.commands.inflight, key)
+	s.commands.mu.Unlock()
+
+	s.late.drop(key)
+	if !ok {
+		return "진행 중인 답변이 없습니다."
+	}
+	call.cancel()
+	return "답변 생성을 중단했습니다."
+}
+
+// setPrefs updates the command choices of the user with the given key
+func (s *Server) setPrefs(key string, update func(*userPrefs)) {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+
+	if s.commands.prefs == nil {
+		s.commands.prefs = make(map[string]userPrefs)
+	}
+	prefs := s.commands.prefs[key]
+	update(&prefs)
+	s.commands.prefs[key] = prefs
+}
+
+// resolve returns the agent settings for senderID after applying their
+// profile and model choices, along with the profile name
+func (s *Server) resolve(config *Config, senderID string) (Profile, string) {
+	s.commands.mu.RLock()
+	prefs := s.commands.prefs[config.userKey(senderID)]
+	s.commands.mu.RUnlock()
+
+	settings := Profile{
+		SystemPrompt: config.SystemPrompt,
+		Model:        config.Model,
+		AllowedTools: config.AllowedTools,
+	}
+
+	profileName := ""
+	if profile, ok := config.Profiles[prefs.Profile]; ok {
+		profileName = prefs.Profile
+		settings = profile.over(settings)
+	}
+
+	// A model chosen with /model only applies while it is still allowed
+	for _, m := range config.AllowedModels {
+		if prefs.Model != "" && m == prefs.Model {
+			settings.Model = prefs.Model
+		}
+	}
+	return settings, profileName
+}
+
+// track registers the cancel function of the in-flight answer for the user
+// with the given key, for /stop, and returns a function that unregisters it
+func (s *Server) track(key string, cancel context.CancelFunc) func() {
+	s.commands.mu.Lock()
+	defer s.commands.mu.Unlock()
+
+	if s.commands.inflight == nil {
+		s.commands.inflight = make(map[string]*inflightCall)
+	}
+	call := &inflightCall{cancel: cancel}
+	s.commands.inflight[key] = call
+
+	return func() {
+		s.commands.mu.Lock()
+		defer s.commands.mu.Unlock()
+		if s.commands.inflight[key] == call {
+			delete(s.commands.inflight, key)
+		}
+	}
+}
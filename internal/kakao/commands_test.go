@@ -0,0 +1,122 @@
+package kakao
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func replyText(t *testing.T, s *Server, userID, utterance string) string {
+	t.Helper()
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest(userID, utterance), nil)
+	return resp.Template.Outputs[0].SimpleText.Text
+}
+
+func TestCommandResetAndHelp(t *testing.T) {
+	s, srv := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	replyText(t, s, "u1", "안녕")
+	if got := replyText(t, s, "u1", "/reset"); got != "대화 내용을 초기화했습니다." {
+		t.Errorf("/reset = %q", got)
+	}
+	if history := s.agent.GetSessionHistory(sessionID(userKey(mainBot, "u1"))); len(history) != 0 {
+		t.Errorf("history has %d messages after /reset", len(history))
+	}
+
+	help := replyText(t, s, "u1", "/help")
+	for _, name := range []string{"/reset", "/model", "/profile", "/usage", "/stop"} {
+		if !strings.Contains(help, name) {
+			t.Errorf("/help does not list %s: %q", name, help)
+		}
+	}
+	if got := replyText(t, s, "u1", "/nope"); !strings.Contains(got, "알 수 없는 명령어") {
+		t.Errorf("unknown command = %q", got)
+	}
+	if n := len(srv.ChatRequests()); n != 1 {
+		t.Errorf("commands reached the LLM: %d calls", n)
+	}
+}
+
+func TestCommandUsageWithoutRateLimit(t *testing.T) {
+	s, _ := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	replyText(t, s, "u1", "안녕")
+	replyText(t, s, "u1", "또 안녕")
+	// The /usage message itself counts too
+	if got := replyText(t, s, "u1", "/usage"); got != "오늘 보낸 메시지: 3" {
+		t.Errorf("/usage = %q", got)
+	}
+}
+
+func TestCommandModelAndProfile(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetModels("qwen2.5:0.5b", "llama3.2")
+	cfg := DefaultConfig()
+	cfg.AllowedModels = []string{"llama3.2"}
+	cfg.Profiles = map[string]Profile{"번역": {SystemPrompt: "당신은 번역가입니다."}}
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	if got := replyText(t, s, "u1", "/model gpt-4"); !strings.Contains(got, "사용할 수 없는 모델") {
+		t.Errorf("disallowed model: %q", got)
+	}
+	replyText(t, s, "u1", "/model llama3.2")
+	replyText(t, s, "u1", "/profile 번역")
+	replyText(t, s, "u1", "hello")
+
+	req := srv.ChatRequests()[0]
+	if req.Model != "llama3.2" {
+		t.Errorf("model = %q", req.Model)
+	}
+	if !strings.HasPrefix(req.Messages[0].Content, "당신은 번역가입니다.") {
+		t.Errorf("system prompt = %q", req.Messages[0].Content)
+	}
+}
+
+func TestCommandPermissions(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.RegisterCommand(Command{
+		Name:       "ping",
+		Usage:      "/ping",
+		Permission: PermissionAdmin,
+		Handler:    func(ctx CommandContext) string { return "pong " + ctx.Args },
+	})
+	cfg := DefaultConfig()
+	cfg.Admins = []string{"admin"}
+	cfg.CommandPermissions = map[string]string{"usage": PermissionDisabled}
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	if got := replyText(t, s, "u1", "/ping"); !strings.Contains(got, "권한이 없습니다") {
+		t.Errorf("non-admin /ping = %q", got)
+	}
+	if got := replyText(t, s, "admin", "/ping a b"); got != "pong a b" {
+		t.Errorf("admin /ping = %q", got)
+	}
+	if got := replyText(t, s, "admin", "/usage"); !strings.Contains(got, "알 수 없는 명령어") {
+		t.Errorf("disabled /usage = %q", got)
+	}
+	if help := replyText(t, s, "u1", "/help"); strings.Contains(help, "/ping") {
+		t.Errorf("/help lists a command the user can't run: %q", help)
+	}
+}
+
+func TestCommandStop(t *testing.T) {
+	s := newSlowServer(t, 2*time.Second)
+
+	if got := replyText(t, s, "u1", "긴 질문"); got != lateReplyText {
+		t.Fatalf("first reply = %q", got)
+	}
+	if got := replyText(t, s, "u1", "/stop"); got != "답변 생성을 중단했습니다." {
+		t.Errorf("/stop = %q", got)
+	}
+	if got := replyText(t, s, "u1", "/stop"); got != "진행 중인 답변이 없습니다." {
+		t.Errorf("second /stop = %q", got)
+	}
+}
@@ -0,0 +1,379 @@
+package kakao
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	conversationDayLayout   = "2006-01-02"
+	defaultConversationPage = 50
+	maxConversationPage     = 500
+	takeoverText            = "담당자가 메시지를 확인하고 있습니다. 잠시만 기다려 주세요."
+)
+
+// Conversation is one exchange with a Kakao user
+type Conversation struct {
+	Time      time.Time `json:"time"`
+	Bot       string    `json:"bot"`
+	SenderID  string    `json:"senderId"`
+	Utterance string    `json:"utterance"`
+	Response  string    `json:"response"`
+	LatencyMs int64     `json:"latencyMs"`
+	Model     string    `json:"model,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Manual    bool      `json:"manual,omitempty"`    // sent by an admin from the inbox
+	Pending   bool      `json:"pending,omitempty"`   // waiting for an admin while taken over
+	Simulated bool      `json:"simulated,omitempty"` // sent from the simulator
+}
+
+// ConversationQuery selects log entries, newest first
+type ConversationQuery struct {
+	SenderID string `json:"senderId"`
+	Bot      string `json:"bot"`
+	Search   string `json:"search"` // case-insensitive, in utterance or response
+	Offset   int    `json:"offset"`
+	Limit    int    `json:"limit"`
+}
+
+// ConversationPage is one page of query results
+type ConversationPage struct {
+	Entries []Conversation `json:"entries"`
+	Total   int            `json:"total"`
+}
+
+// conversationLog keeps one JSON-lines file per day. With no directory set,
+// nothing is recorded.
+type conversationLog struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func (l *conversationLog) setDir(dir string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dir = dir
+}
+
+func (l *conversationLog) record(c Conversation) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.dir, c.Time.Local().Format(conversationDayLayout)+".jsonl")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// days returns the day files, newest first
+func (l *conversationLog) days() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, e := range entries {
+		name := e.Name()
+		if _, err := time.Parse(conversationDayLayout, strings.TrimSuffix(name, ".jsonl")); err == nil && strings.HasSuffix(name, ".jsonl") {
+			days = append(days, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	return days, nil
+}
+
+func (l *conversationLog) query(q ConversationQuery) (*ConversationPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultConversationPage
+	}
+	if q.Limit > maxConversationPage {
+		q.Limit = maxConversationPage
+	}
+	search := strings.ToLower(q.Search)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	page := &ConversationPage{Entries: []Conversation{}}
+	if l.dir == "" {
+		return page, nil
+	}
+	days, err := l.days()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversations: %w", err)
+	}
+
+	for _, day := range days {
+		var matches []Conversation
+		err := readConversations(filepath.Join(l.dir, day), func(c Conversation) {
+			if q.SenderID != "" && c.SenderID != q.SenderID {
+				return
+			}
+			if q.Bot != "" && c.Bot != q.Bot {
+				return
+			}
+			if search != "" && !strings.Contains(strings.ToLower(c.Utterance), search) &&
+				!strings.Contains(strings.ToLower(c.Response), search) {
+				return
+			}
+			matches = append(matches, c)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read conversations: %w", err)
+		}
+
+		for i := len(matches) - 1; i >= 0; i-- {
+			if page.Total >= q.Offset && len(page.Entries) < q.Limit {
+				page.Entries = append(page.Entries, matches[i])
+			}
+			page.Total++
+		}
+	}
+	return page, nil
+}
+
+// prune deletes the day files older than the retention period
+func (l *conversationLog) prune(retentionDays int, now time.Time) {
+	if retentionDays <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -retentionDays).Format(conversationDayLayout)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dir == "" {
+		return
+	}
+	days, err := l.days()
+	if err != nil {
+		return
+	}
+	for _, day := range days {
+		if strings.TrimSuffix(day, ".jsonl") < cutoff {
+			if err := os.Remove(filepath.Join(l.dir, day)); err != nil {
+				log.Printf("[kakao] Failed to prune conversations %s: %v", day, err)
+			}
+		}
+	}
+}
+
+func readConversations(path string, fn func(Conversation)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var c Conversation
+		if json.Unmarshal(scanner.Bytes(), &c) == nil {
+			fn(c)
+		}
+	}
+	return scanner.Err()
+}
+
+// logConversation records an exchange and passes it to the inbox
+func (s *Server) logConversation(config *Config, c Conversation) {
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	c.Simulated = config.simulated
+	if config.ConversationLog {
+		if err := s.conversations.record(c); err != nil {
+			log.Printf("[kakao] Failed to record conversation: %v", err)
+		}
+	}
+	s.emit("kakao:message", c)
+}
+
+// logExchange records the answer to a message
+func (s *Server) logExchange(config *Config, senderID, message string, ans answer, latency time.Duration) {
+	c := Conversation{
+		Bot:       config.bot,
+		SenderID:  senderID,
+		Utterance: message,
+		Response:  ans.text,
+		LatencyMs: latency.Milliseconds(),
+		Model:     ans.model,
+	}
+	if ans.err != nil {
+		c.Error = ans.err.Error()
+	}
+	s.logConversation(config, c)
+}
+
+// logReply records a message answered without running the agent
+func (s *Server) logReply(config *Config, senderID, message, response string, received time.Time) {
+	s.logConversation(config, Conversation{
+		Bot:       config.bot,
+		SenderID:  senderID,
+		Utterance: message,
+		Response:  response,
+		LatencyMs: time.Since(received).Milliseconds(),
+	})
+}
+
+// Conversations pages through the conversation log, newest first
+func (s *Server) Conversations(q ConversationQuery) (*ConversationPage, error) {
+	return s.conversations.query(q)
+}
+
+// inbox tracks conversations an admin has taken over from the agent
+type inbox struct {
+	mu        sync.Mutex
+	takenOver map[string]TakenOverUser // user key -> user
+	waiting   map[string]waitingCallback
+}
+
+// TakenOverUser is a user of a bot whose conversation an admin has taken over
+type TakenOverUser struct {
+	Bot      string `json:"bot"`
+	SenderID string `json:"senderId"`
+}
+
+// waitingCallback is a callback URL a manual reply can still use
+type waitingCallback struct {
+	url      string
+	received time.Time
+}
+
+func (in *inbox) has(key string) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	_, ok := in.takenOver[key]
+	return ok
+}
+
+// TakeOver stops the agent of bot from answering senderID; their messages
+// wait in the inbox for a manual reply
+func (s *Server) TakeOver(bot, senderID string) {
+	if bot == "" {
+		bot = mainBot
+	}
+	s.inbox.mu.Lock()
+	defer s.inbox.mu.Unlock()
+	if s.inbox.takenOver == nil {
+		s.inbox.takenOver = make(map[string]TakenOverUser)
+	}
+	s.inbox.takenOver[userKey(bot, senderID)] = TakenOverUser{Bot: bot, SenderID: senderID}
+	log.Printf("[kakao] Conversation with %s on %s taken over", senderID, bot)
+}
+
+// Release hands a conversation back to the agent
+func (s *Server) Release(bot, senderID string) {
+	key := userKey(bot, senderID)
+	s.inbox.mu.Lock()
+	defer s.inbox.mu.Unlock()
+	delete(s.inbox.takenOver, key)
+	delete(s.inbox.waiting, key)
+	log.Printf("[kakao] Conversation with %s on %s released", senderID, bot)
+}
+
+// TakenOver returns the users whose conversations an admin has taken over
+func (s *Server) TakenOver() []TakenOverUser {
+	s.inbox.mu.Lock()
+	defer s.inbox.mu.Unlock()
+	users := make([]TakenOverUser, 0, len(s.inbox.takenOver))
+	for _, u := range s.inbox.takenOver {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Bot != users[j].Bot {
+			return users[i].Bot < users[j].Bot
+		}
+		return users[i].SenderID < users[j].SenderID
+	})
+	return users
+}
+
+// SendReply sends an admin's reply to senderID on bot. It goes through the
+// callback of the user's last message while that is still valid, and is
+// otherwise kept for the user's next message.
+func (s *Server) SendReply(bot, senderID, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("reply is empty")
+	}
+
+	key := userKey(bot, senderID)
+	s.inbox.mu.Lock()
+	user, ok := s.inbox.takenOver[key]
+	waiting, hasCallback := s.inbox.waiting[key]
+	delete(s.inbox.waiting, key)
+	s.inbox.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("conversation with %s is not taken over", senderID)
+	}
+
+	if hasCallback && time.Since(waiting.received) < callbackWindow {
+		go s.deliverCallback(waiting.url, senderID, waiting.received, s.renderReply(key, text))
+	} else if !s.late.add(key, text) {
+		return fmt.Errorf("an answer to %s is still being generated", senderID)
+	}
+
+	config := s.GetConfig()
+	c := Conversation{Bot: user.Bot, SenderID: senderID, Response: text, Manual: true}
+	s.logConversation(config, c)
+	return nil
+}
+
+// waitForAdmin answers a message in a taken-over conversation: a reply the
+// admin already sent is delivered, otherwise the message waits in the inbox
+func (s *Server) waitForAdmin(w http.ResponseWriter, config *Config, callbackURL, senderID, message string) {
+	received := time.Now()
+	key := config.userKey(senderID)
+	if late, ready := s.late.take(key, s.replyTimeout(config)); ready {
+		s.logReply(config, senderID, message, late.text, received)
+		sendJSON(w, http.StatusOK, s.renderReply(key, late.text))
+		return
+	}
+
+	s.logConversation(config, Conversation{Bot: config.bot, SenderID: senderID, Utterance: message, Pending: true})
+
+	if callbackURL != "" {
+		s.inbox.mu.Lock()
+		if s.inbox.waiting == nil {
+			s.inbox.waiting = make(map[string]waitingCallback)
+		}
+		s.inbox.waiting[key] = waitingCallback{url: callbackURL, received: time.Now()}
+		s.inbox.mu.Unlock()
+		sendJSON(w, http.StatusOK, NewCallbackInitialResponse())
+		return
+	}
+	sendJSON(w, http.StatusOK, NewSimpleTextResponse(takeoverText))
+}
@@ -0,0 +1,186 @@
+package kakao
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConversationLogSearchAndPaging(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("답변")
+	s.SetDataDir(t.TempDir())
+	cfg := DefaultConfig()
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "첫 번째 질문"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u2", "휴가 신청 방법"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "두 번째 질문"), nil)
+
+	page, err := s.Conversations(ConversationQuery{SenderID: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Entries[0].Utterance != "두 번째 질문" {
+		t.Fatalf("u1 page = %+v", page)
+	}
+	if e := page.Entries[0]; e.Response != "답변" || e.Model != "qwen2.5:0.5b" || e.Bot != mainBot {
+		t.Errorf("entry = %+v", e)
+	}
+
+	page, _ = s.Conversations(ConversationQuery{Search: "휴가"})
+	if page.Total != 1 || page.Entries[0].SenderID != "u2" {
+		t.Errorf("search page = %+v", page)
+	}
+
+	page, _ = s.Conversations(ConversationQuery{Offset: 1, Limit: 1})
+	if page.Total != 3 || len(page.Entries) != 1 || page.Entries[0].Utterance != "휴가 신청 방법" {
+		t.Errorf("second page = %+v", page)
+	}
+}
+
+func TestConversationRetention(t *testing.T) {
+	dir := t.TempDir()
+	var log conversationLog
+	log.setDir(dir)
+
+	now := time.Now()
+	old := Conversation{Time: now.AddDate(0, 0, -40), SenderID: "u1"}
+	recent := Conversation{Time: now.AddDate(0, 0, -1), SenderID: "u1"}
+	log.record(old)
+	log.record(recent)
+
+	log.prune(30, now)
+
+	if _, err := os.Stat(filepath.Join(dir, old.Time.Format(conversationDayLayout)+".jsonl")); !os.IsNotExist(err) {
+		t.Errorf("old day kept: %v", err)
+	}
+	if page, _ := log.query(ConversationQuery{}); page.Total != 1 {
+		t.Errorf("total = %d, want 1", page.Total)
+	}
+}
+
+func TestConversationLogRecordsRejectedMessages(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cfg := DefaultConfig()
+	cfg.DMPolicy = "allowlist"
+	cfg.AllowFrom = []string{"u1"}
+	cfg.RateLimit = RateLimit{Enabled: true, PerUserPerMinute: 1, PerUserBurst: 1}
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u2", "안녕"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "또 안녕"), nil)
+
+	page, _ := s.Conversations(ConversationQuery{})
+	if page.Total != 3 {
+		t.Fatalf("entries = %+v", page.Entries)
+	}
+	if e := page.Entries[0]; e.Utterance != "또 안녕" || e.Error != "limited: user rate" {
+		t.Errorf("limited entry = %+v", e)
+	}
+	if e := page.Entries[2]; e.SenderID != "u2" || e.Response != "접근이 허용되지 않았습니다." {
+		t.Errorf("denied entry = %+v", e)
+	}
+}
+
+func TestTakeOverHoldsReply(t *testing.T) {
+	s, srv := newTestServer(t)
+	s.SetDataDir(t.TempDir())
+	cfg := DefaultConfig()
+	cfg.ReplyTimeoutMs = 50
+	s.UpdateConfig(cfg)
+
+	s.TakeOver(mainBot, "u1")
+	if got := replyText(t, s, "u1", "사람이랑 얘기하고 싶어요"); got != takeoverText {
+		t.Errorf("reply = %q", got)
+	}
+	if n := len(srv.ChatRequests()); n != 0 {
+		t.Errorf("agent answered %d times while taken over", n)
+	}
+
+	if err := s.SendReply(mainBot, "u1", "담당자입니다. 무엇을 도와드릴까요?"); err != nil {
+		t.Fatal(err)
+	}
+	if got := replyText(t, s, "u1", "네"); got != "담당자입니다. 무엇을 도와드릴까요?" {
+		t.Errorf("manual reply = %q", got)
+	}
+
+	page, _ := s.Conversations(ConversationQuery{SenderID: "u1"})
+	if page.Total != 3 || page.Entries[0].Utterance != "네" || !page.Entries[1].Manual || !page.Entries[2].Pending {
+		t.Errorf("inbox log = %+v", page.Entries)
+	}
+
+	s.Release(mainBot, "u1")
+	if err := s.SendReply(mainBot, "u1", "늦은 답장"); err == nil {
+		t.Error("reply to released conversation accepted")
+	}
+}
+
+func TestTakeOverRepliesAddUp(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.TakeOver(mainBot, "u1")
+
+	// An answer still being generated can't be joined
+	key := userKey(mainBot, "u1")
+	pending := make(chan string)
+	s.late.hold(key, "질문", pending)
+	if err := s.SendReply(mainBot, "u1", "담당자입니다."); err == nil {
+		t.Error("reply accepted while an answer is pending")
+	}
+	pending <- "자동 답변"
+	s.late.mu.Lock()
+	done := s.late.replies[key].done
+	s.late.mu.Unlock()
+	<-done
+
+	for _, text := range []string{"담당자입니다.", "확인해 드릴게요."} {
+		if err := s.SendReply(mainBot, "u1", text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := replyText(t, s, "u1", "네"); got != "자동 답변\n\n담당자입니다.\n\n확인해 드릴게요." {
+		t.Errorf("reply = %q", got)
+	}
+}
+
+func TestTakeOverReplyViaCallback(t *testing.T) {
+	bodies := make(chan KakaoResponse, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var resp KakaoResponse
+		json.Unmarshal(data, &resp)
+		bodies <- resp
+		w.Write([]byte(`{"taskId":"t1","status":"SUCCESS"}`))
+	}))
+	defer callback.Close()
+
+	s, _ := newTestServer(t)
+	s.TakeOver(mainBot, "u1")
+
+	req := userRequest("u1", "문의드립니다")
+	req.UserRequest.CallbackURL = callback.URL
+	_, resp := postWebhook(t, s, "/kakao/webhook", req, nil)
+	if resp.UseCallback == nil || !*resp.UseCallback {
+		t.Fatalf("expected callback response, got %+v", resp)
+	}
+
+	if err := s.SendReply(mainBot, "u1", "확인했습니다"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-bodies:
+		if got.Template.Outputs[0].SimpleText.Text != "확인했습니다" {
+			t.Errorf("callback body = %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("manual reply not delivered")
+	}
+}
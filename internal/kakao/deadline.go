@@ -0,0 +1,298 @@
+package kakao
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReplyTimeout stays under Open Builder's 5 second skill timeout
+const defaultReplyTimeout = 4500 * time.Millisecond
+
+// generationTimeout bounds a reply that has no callback to wait for
+const generationTimeout = 2 * time.Minute
+
+// lateReplyTTL is how long an answer that missed the deadline is kept for
+// the user's next message
+const lateReplyTTL = 10 * time.Minute
+
+// maxQueuedMessages caps the messages answered after a pending late reply
+const maxQueuedMessages = 3
+
+const (
+	lateReplyText   = "답변을 준비하는 데 시간이 걸리고 있어요. 잠시 후 다시 물어봐 주세요."
+	lateReplyPrefix = "이전 질문에 대한 답변입니다.\n\n"
+	queuedReplyNote = "\n\n이어서 보내주신 메시지에 대한 답변도 준비하고 있어요. 잠시 후 다시 말을 걸어 주세요."
+)
+
+// lateReply is an answer that did not make the skill deadline
+type lateReply struct {
+	question string // the message answered; empty for an admin's reply
+	done     chan struct{}
+	text     string
+	expires  time.Time
+	queued   []queuedMessage // arrived while the answer was being generated
+}
+
+// queuedMessage is a message to answer once the pending reply is delivered
+type queuedMessage struct {
+	config  *Config
+	message string
+	run     func(ctx context.Context) answer
+}
+
+// lateReplies holds late answers per sender until they are picked up
+type lateReplies struct {
+	mu      sync.Mutex
+	replies map[string]*lateReply
+}
+
+// hold waits for the answer to question in the background and keeps it for
+// key
+func (l *lateReplies) hold(key, question string, result <-chan string) {
+	reply := &lateReply{question: question, done: make(chan struct{})}
+
+	l.mu.Lock()
+	if l.replies == nil {
+		l.replies = make(map[string]*lateReply)
+	}
+	l.replies[key] = reply
+	l.mu.Unlock()
+
+	go func() {
+		text := <-result
+		l.mu.Lock()
+		reply.text = text
+		reply.expires = time.Now().Add(lateReplyTTL)
+		l.mu.Unlock()
+		close(reply.done)
+	}()
+}
+
+// add keeps text for key after the answer already held for it, if any. It
+// returns false if an earlier answer is still being generated.
+func (l *lateReplies) add(key, text string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if reply, ok := l.replies[key]; ok {
+		select {
+		case <-reply.done:
+		default:
+			return false
+		}
+		if now.Before(reply.expires) {
+			reply.text += "\n\n" + text
+			reply.expires = now.Add(lateReplyTTL)
+			return true
+		}
+	}
+
+	reply := &lateReply{done: make(chan struct{}), text: text, expires: now.Add(lateReplyTTL)}
+	close(reply.done)
+	if l.replies == nil {
+		l.replies = make(map[string]*lateReply)
+	}
+	l.replies[key] = reply
+	return true
+}
+
+// drop forgets the late answer for key
+func (l *lateReplies) drop(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.replies, key)
+}
+
+// queue adds a message to answer after the pending reply for key. It
+// returns false if no reply is pending anymore.
+func (l *lateReplies) queue(key string, q queuedMessage) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reply, ok := l.replies[key]
+	if !ok {
+		return false
+	}
+	if len(reply.queued) < maxQueuedMessages {
+		reply.queued = append(reply.queued, q)
+	}
+	return true
+}
+
+// take returns the late answer for key, with the messages queued behind
+// it, waiting up to timeout if it is still being generated. reply is nil if
+// nothing is pending; ready is false if the answer is still not done, in
+// which case it stays held.
+func (l *lateReplies) take(key string, timeout time.Duration) (reply *lateReply, ready bool) {
+	l.mu.Lock()
+	reply, ok := l.replies[key]
+	l.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-reply.done:
+	case <-timer.C:
+		return reply, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.replies[key] == reply {
+		delete(l.replies, key)
+	}
+	if time.Now().After(reply.expires) {
+		return nil, false
+	}
+	return reply, true
+}
+
+// prune drops answers that were never picked up before they expired
+func (l *lateReplies) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, reply := range l.replies {
+		select {
+		case <-reply.done:
+			if now.After(reply.expires) {
+				delete(l.replies, key)
+			}
+		default:
+		}
+	}
+}
+
+// replyTimeout returns the configured skill deadline
+func (s *Server) replyTimeout(config *Config) time.Duration {
+	if ms := config.ReplyTimeoutMs; ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultReplyTimeout
+}
+
+// reply answers a skill request with the result of run, racing it against
+// the skill deadline. A late answer is delivered through the callback URL if
+// the block has callbacks enabled, or kept for the user's next message
+// otherwise.
+func (s *Server) reply(w http.ResponseWriter, config *Config, callbackURL, senderID, message string, run func(ctx context.Context) answer) {
+	received := time.Now()
+	deadline := received.Add(s.replyTimeout(config))
+	key := config.userKey(senderID)
+
+	// "더보기" continues the previous long answer
+	if message == moreLabel {
+		if resp, ok := s.nextPage(key); ok {
+			s.logReply(config, senderID, message, PreviewResponse(resp), received)
+			sendJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+
+	// An earlier answer that missed the deadline comes first. It is the
+	// reply to this turn only if the user asks the same again; anything else
+	// is answered as well, after it.
+	q := queuedMessage{config: config, message: message, run: run}
+	var held string
+	if late, ready := s.late.take(key, time.Until(deadline)); late != nil {
+		if !ready {
+			if s.late.queue(key, q) {
+				sendJSON(w, http.StatusOK, NewSimpleTextResponse(lateReplyText))
+				return
+			}
+		} else {
+			held = lateReplyPrefix + late.text
+			queued := late.queued
+			if len(queued) > 0 && message != late.question {
+				// Answer this message along with the ones queued before it
+				queued = append(queued, q)
+			}
+			if len(queued) > 0 {
+				s.answerQueued(key, senderID, queued)
+				held += queuedReplyNote
+			}
+			// Otherwise a new message is answered now, after the held answer
+			if message == late.question || len(queued) > 0 {
+				s.logReply(config, senderID, message, held, received)
+				sendJSON(w, http.StatusOK, s.renderReply(key, held))
+				return
+			}
+		}
+	}
+
+	result := s.generate(config, callbackURL, senderID, message, received, run)
+	withHeld := func(response string) string {
+		if held == "" {
+			return response
+		}
+		return held + "\n\n" + response
+	}
+
+	// The wait for an earlier answer counts against the deadline too
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case response := <-result:
+		sendJSON(w, http.StatusOK, s.renderReply(key, withHeld(response)))
+	case <-timer.C:
+		if callbackURL != "" {
+			log.Printf("[kakao] Reply to %s missed the deadline, switching to callback", senderID)
+			go func() {
+				s.deliverCallback(callbackURL, senderID, received, s.renderReply(key, withHeld(<-result)))
+			}()
+			sendJSON(w, http.StatusOK, NewCallbackInitialResponse())
+			return
+		}
+		log.Printf("[kakao] Reply to %s missed the deadline, holding it for the next message", senderID)
+		s.late.hold(key, message, result)
+		if held != "" {
+			sendJSON(w, http.StatusOK, s.renderReply(key, held+"\n\n"+lateReplyText))
+			return
+		}
+		sendJSON(w, http.StatusOK, NewSimpleTextResponse(lateReplyText))
+	}
+}
+
+// generate runs a message in the background, logging the exchange, and
+// returns the channel its reply arrives on
+func (s *Server) generate(config *Config, callbackURL, senderID, message string, received time.Time, run func(ctx context.Context) answer) <-chan string {
+	result := make(chan string, 1)
+	go func() {
+		// Past the callback window an answer can't be delivered anymore, so
+		// don't keep generating it
+		limit := received.Add(generationTimeout)
+		if callbackURL != "" {
+			limit = received.Add(callbackWindow)
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), limit)
+		defer cancel()
+
+		ans := run(ctx)
+		s.logExchange(config, senderID, message, ans, time.Since(received))
+		result <- ans.text
+	}()
+	return result
+}
+
+// answerQueued answers the messages that arrived while an earlier reply was
+// pending, in order, and holds the answers for the user's next message
+func (s *Server) answerQueued(key, senderID string, queued []queuedMessage) {
+	result := make(chan string, 1)
+	go func() {
+		answers := make([]string, 0, len(queued))
+		for _, q := range queued {
+			answers = append(answers, <-s.generate(q.config, "", senderID, q.message, time.Now(), q.run))
+		}
+		result <- strings.Join(answers, "\n\n")
+	}()
+	s.late.hold(key, queued[len(queued)-1].message, result)
+}
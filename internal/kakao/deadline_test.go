@@ -0,0 +1,164 @@
+package kakao
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"DubaiCrab/internal/ollama/ollamatest"
+)
+
+func newSlowServer(t *testing.T, latency time.Duration) *Server {
+	t.Helper()
+	s, srv := newTestServer(t)
+	srv.SetChatReply("늦은 답변")
+	srv.SetLatency("/api/chat", latency)
+
+	cfg := DefaultConfig()
+	cfg.ReplyTimeoutMs = 50
+	s.UpdateConfig(cfg)
+	return s
+}
+
+func TestReplyHeldForNextMessage(t *testing.T) {
+	s := newSlowServer(t, 200*time.Millisecond)
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "질문"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != lateReplyText {
+		t.Fatalf("first reply = %q, want the try-again text", got)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "질문"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; !strings.HasSuffix(got, "늦은 답변") {
+		t.Errorf("second reply = %q, want the held answer", got)
+	}
+}
+
+func TestReplyAnswersNewQuestionAfterHeldReply(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatFunc(func(req ollamatest.ChatRequest) string {
+		question := req.Messages[len(req.Messages)-1].Content
+		if question == "느린 질문" {
+			time.Sleep(150 * time.Millisecond)
+		}
+		return "답: " + question
+	})
+	cfg := DefaultConfig()
+	cfg.ReplyTimeoutMs = 50
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "느린 질문"), nil)
+	time.Sleep(200 * time.Millisecond)
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "다른 질문"), nil)
+	got := resp.Template.Outputs[0].SimpleText.Text
+	if !strings.HasPrefix(got, lateReplyPrefix+"답: 느린 질문") || !strings.HasSuffix(got, "답: 다른 질문") {
+		t.Errorf("reply = %q, want the held answer followed by the new one", got)
+	}
+}
+
+func TestReplyQueuesMessageWhilePending(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatFunc(func(req ollamatest.ChatRequest) string {
+		return "답: " + req.Messages[len(req.Messages)-1].Content
+	})
+	srv.SetLatency("/api/chat", 150*time.Millisecond)
+	cfg := DefaultConfig()
+	cfg.ReplyTimeoutMs = 50
+	cfg.RateLimit.Enabled = false
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "첫 질문"), nil)
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "둘째 질문"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != lateReplyText {
+		t.Fatalf("reply while pending = %q", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "확인"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; !strings.Contains(got, "답: 첫 질문") || !strings.HasSuffix(got, queuedReplyNote) {
+		t.Fatalf("held reply = %q", got)
+	}
+
+	// "확인" was queued behind "둘째 질문", so asking it again picks up both
+	time.Sleep(400 * time.Millisecond)
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "확인"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; !strings.Contains(got, "답: 둘째 질문") || !strings.HasSuffix(got, "답: 확인") {
+		t.Errorf("queued message answer = %q", got)
+	}
+}
+
+func TestLateRepliesPrune(t *testing.T) {
+	var l lateReplies
+	result := make(chan string, 1)
+	result <- "답변"
+	l.hold("u1", "질문", result)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		l.mu.Lock()
+		done := !l.replies["u1"].expires.IsZero()
+		l.mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	l.prune(time.Now())
+	if len(l.replies) != 1 {
+		t.Fatal("pruned a reply before it expired")
+	}
+	l.prune(time.Now().Add(lateReplyTTL + time.Minute))
+	if len(l.replies) != 0 {
+		t.Errorf("expired reply kept: %d left", len(l.replies))
+	}
+}
+
+func TestReplySwitchesToCallback(t *testing.T) {
+	s := newSlowServer(t, 200*time.Millisecond)
+
+	received := make(chan KakaoResponse, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp KakaoResponse
+		json.NewDecoder(r.Body).Decode(&resp)
+		received <- resp
+	}))
+	defer callback.Close()
+
+	req := userRequest("u1", "질문")
+	req.UserRequest.CallbackURL = callback.URL
+	_, resp := postWebhook(t, s, "/kakao/webhook", req, nil)
+	if resp.UseCallback == nil || !*resp.UseCallback {
+		t.Fatalf("expected useCallback, got %+v", resp)
+	}
+
+	select {
+	case resp := <-received:
+		if got := resp.Template.Outputs[0].SimpleText.Text; got != "늦은 답변" {
+			t.Errorf("callback text = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not delivered")
+	}
+}
+
+func TestReplyFastAnswerSkipsCallback(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("빠른 답변")
+
+	req := userRequest("u1", "질문")
+	req.UserRequest.CallbackURL = "http://127.0.0.1:1/unused"
+	_, resp := postWebhook(t, s, "/kakao/webhook", req, nil)
+	if resp.UseCallback != nil {
+		t.Fatalf("fast answer used callback: %+v", resp)
+	}
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "빠른 답변" {
+		t.Errorf("reply = %q", got)
+	}
+}
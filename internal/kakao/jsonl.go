@@ -0,0 +1,198 @@
+package kakao
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DefaultDataDir returns the directory for Kakao logs and state
+func DefaultDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "dubai-crab", "kakao"), nil
+}
+
+// jsonlLog is an append-only JSON-lines file. With no path set, appends are
+// dropped. If maxBytes is set, a full file is rotated to path + ".1",
+// replacing the previous one.
+type jsonlLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+func (l *jsonlLog) setPath(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+}
+
+// append writes v as one line
+func (l *jsonlLog) append(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	if l.maxBytes > 0 {
+		if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(data))+1 > l.maxBytes {
+			if err := os.Rename(l.path, l.path+".1"); err != nil {
+				return err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// tail calls fn for up to n of the last lines, newest first, reading the
+// file backwards so only the tail is loaded; n <= 0 reads every line. The
+// rotated file is read after the current one.
+func (l *jsonlLog) tail(n int, fn func(line []byte) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+
+	count := 0
+	for _, path := range []string{l.path, l.path + ".1"} {
+		if n > 0 && count >= n {
+			break
+		}
+		read, err := tailFile(path, n-count, fn)
+		count += read
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailChunk is how much of a file tail reads at a time
+const tailChunk = 64 * 1024
+
+// tailFile calls fn for up to n of the last lines of path, newest first,
+// and returns how many it read
+func tailFile(path string, n int, fn func(line []byte) error) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	emit := func(line []byte) error {
+		if len(line) == 0 {
+			return nil
+		}
+		count++
+		return fn(line)
+	}
+
+	// buf holds the unread start of the file, whose first line may be
+	// incomplete until the chunk before it is read
+	var buf []byte
+	for pos := info.Size(); pos > 0 && (n <= 0 || count < n); {
+		size := min(tailChunk, pos)
+		pos -= size
+		chunk := make([]byte, size, size+int64(len(buf)))
+		if _, err := f.ReadAt(chunk, pos); err != nil {
+			return count, err
+		}
+		buf = append(chunk, buf...)
+
+		for n <= 0 || count < n {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			if err := emit(buf[i+1:]); err != nil {
+				return count, err
+			}
+			buf = buf[:i]
+		}
+		if pos == 0 && (n <= 0 || count < n) {
+			if err := emit(buf); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// read calls fn for each line in order, skipping lines that fail to parse
+func (l *jsonlLog) read(fn func(line []byte) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// clear removes the file and its rotated copy
+func (l *jsonlLog) clear() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return nil
+	}
+	for _, path := range []string{l.path, l.path + ".1"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package kakao
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordStates collects the states published as kakao:status events. The
+// handler calls back into the server to check events are sent unlocked.
+func recordStates(s *Server) func() []State {
+	var mu sync.Mutex
+	var states []State
+	s.SetEventHandler(func(name string, data interface{}) {
+		if name != "kakao:status" {
+			return
+		}
+		s.GetStatus()
+		mu.Lock()
+		states = append(states, data.(Status).State)
+		mu.Unlock()
+	})
+	return func() []State {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]State(nil), states...)
+	}
+}
+
+func joinStates(states []State) string {
+	parts := make([]string, len(states))
+	for i, st := range states {
+		parts[i] = string(st)
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestStartReportsBindError(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	s, _ := newTestServer(t)
+	states := recordStates(s)
+	cfg := DefaultConfig()
+	cfg.Port = busy.Addr().(*net.TCPAddr).Port
+	s.UpdateConfig(cfg)
+
+	if err := s.Start(); err == nil {
+		t.Fatal("Start succeeded on a busy port")
+	}
+	status := s.GetStatus()
+	if status.State != StateFailed || status.Running || status.Error == "" {
+		t.Errorf("status = %+v", status)
+	}
+	if got := joinStates(states()); got != "starting,failed" {
+		t.Errorf("states = %s", got)
+	}
+
+	// A config update can recover a failed server
+	next := *cfg
+	next.Port = freePort(t)
+	if err := s.UpdateConfig(&next); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	if status := s.GetStatus(); status.State != StateRunning || status.Error != "" {
+		t.Errorf("status after fix = %+v", status)
+	}
+}
+
+func TestLifecycleStates(t *testing.T) {
+	s, _ := newTestServer(t)
+	states := recordStates(s)
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	s.UpdateConfig(cfg)
+
+	if got := s.GetStatus().State; got != StateStopped {
+		t.Errorf("initial state = %s", got)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !healthy(cfg.Port) {
+		t.Error("server not serving after Start returned")
+	}
+	s.Stop()
+
+	if got := joinStates(states()); got != "starting,running,stopping,stopped" {
+		t.Errorf("states = %s", got)
+	}
+}
+
+func TestStopDoesNotWaitForRequests(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	srv.SetLatency("/api/chat", time.Second)
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	cfg.ReplyTimeoutMs = 2000
+	s.UpdateConfig(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(userRequest("u1", "질문"))
+	go testClient.Post(fmt.Sprintf("http://127.0.0.1:%d/kakao/webhook", cfg.Port), "application/json", bytes.NewReader(body))
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	s.Stop()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Stop took %v with a request in flight", elapsed)
+	}
+}
@@ -0,0 +1,308 @@
+package kakao
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pairingCodeTTL is how long a pairing code is valid; codes also rotate
+	// after every successful pairing
+	pairingCodeTTL = 10 * time.Minute
+	// maxPairingAttempts is how many wrong codes, from anyone, rotate the
+	// code so it can't be guessed by brute force
+	maxPairingAttempts = 5
+	// pairingRequestTTL is how long an unanswered request stays pending
+	pairingRequestTTL = 24 * time.Hour
+)
+
+const (
+	pairingPendingText = "아직 승인되지 않은 사용자입니다. 데스크톱 앱에 표시된 페어링 코드를 보내 주시거나 승인을 기다려 주세요."
+	pairingDoneText    = "페어링이 완료되었습니다. 이제 메시지를 보내실 수 있습니다."
+)
+
+// EventFunc receives server events for the UI
+type EventFunc func(name string, data interface{})
+
+// PairedUser is a Kakao user allowed to use a bot through pairing
+type PairedUser struct {
+	ID          string    `json:"id"`
+	Bot         string    `json:"bot"`
+	DisplayName string    `json:"displayName"`
+	PairedAt    time.Time `json:"pairedAt"`
+	Method      string    `json:"method"` // "code" or "approval"
+}
+
+// PairingRequest is an unknown user waiting for approval
+type PairingRequest struct {
+	SenderID    string    `json:"senderId"`
+	Bot         string    `json:"bot"`
+	Message     string    `json:"message"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// PairingCode is the code users send to pair themselves
+type PairingCode struct {
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// pairing holds paired users, persisted as JSON, and pending requests.
+// Both are kept per bot, by user key; the code pairs a user with the bot
+// they send it to.
+type pairing struct {
+	mu       sync.Mutex
+	path     string
+	code     PairingCode
+	failures int // wrong codes tried against the current code
+	paired   map[string]PairedUser
+	pending  map[string]PairingRequest
+}
+
+// load reads the paired users from path and persists there from now on
+func (p *pairing) load(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.path = path
+	p.paired = make(map[string]PairedUser)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var users []PairedUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.Bot == "" {
+			// Saved before pairing was per bot
+			u.Bot = mainBot
+		}
+		p.paired[userKey(u.Bot, u.ID)] = u
+	}
+	return nil
+}
+
+func (p *pairing) saveLocked() error {
+	if p.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p.path, data, 0600)
+}
+
+func (p *pairing) listLocked() []PairedUser {
+	users := make([]PairedUser, 0, len(p.paired))
+	for _, u := range p.paired {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].PairedAt.Before(users[j].PairedAt) })
+	return users
+}
+
+// currentCode returns the pairing code, rotating it if it expired
+func (p *pairing) currentCode(now time.Time) PairingCode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.currentCodeLocked(now)
+}
+
+func (p *pairing) currentCodeLocked(now time.Time) PairingCode {
+	if p.code.Code == "" || now.After(p.code.ExpiresAt) {
+		p.rotateLocked(now)
+	}
+	return p.code
+}
+
+func (p *pairing) rotateLocked(now time.Time) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		n = big.NewInt(now.UnixNano() % 1000000)
+	}
+	p.code = PairingCode{Code: fmt.Sprintf("%06d", n.Int64()), ExpiresAt: now.Add(pairingCodeTTL)}
+	p.failures = 0
+}
+
+func (p *pairing) isPaired(bot, senderID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.paired[userKey(bot, senderID)]
+	return ok
+}
+
+// tryCode pairs senderID with bot if message is the current code. A message that
+// looks like a code but is wrong counts as a failed attempt; rotated reports
+// whether it used up the attempts and replaced the code.
+func (p *pairing) tryCode(bot, senderID, message string, now time.Time) (paired, rotated bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	code := p.currentCodeLocked(now)
+	attempt := strings.TrimSpace(message)
+	if attempt != code.Code {
+		if !looksLikeCode(attempt) {
+			return false, false, nil
+		}
+		p.failures++
+		if p.failures >= maxPairingAttempts {
+			p.rotateLocked(now)
+			return false, true, nil
+		}
+		return false, false, nil
+	}
+	p.rotateLocked(now)
+	return true, false, p.pairLocked(bot, senderID, "", "code", now)
+}
+
+// looksLikeCode reports whether s has the shape of a pairing code
+func looksLikeCode(s string) bool {
+	if len(s) != 6 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pairing) pairLocked(bot, senderID, displayName, method string, now time.Time) error {
+	if p.paired == nil {
+		p.paired = make(map[string]PairedUser)
+	}
+	key := userKey(bot, senderID)
+	delete(p.pending, key)
+	p.paired[key] = PairedUser{ID: senderID, Bot: bot, DisplayName: displayName, PairedAt: now, Method: method}
+	return p.saveLocked()
+}
+
+// request records a pending request, reporting whether it is new
+func (p *pairing) request(bot, senderID, message string, now time.Time) (PairingRequest, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending == nil {
+		p.pending = make(map[string]PairingRequest)
+	}
+	for key, req := range p.pending {
+		if now.Sub(req.RequestedAt) > pairingRequestTTL {
+			delete(p.pending, key)
+		}
+	}
+
+	key := userKey(bot, senderID)
+	if req, ok := p.pending[key]; ok {
+		return req, false
+	}
+	req := PairingRequest{SenderID: senderID, Bot: bot, Message: message, RequestedAt: now}
+	p.pending[key] = req
+	return req, true
+}
+
+// checkPairing handles a message from a user who is not allowed yet: the
+// pairing code pairs them with the bot, anything else files a pending request
+func (s *Server) checkPairing(config *Config, senderID, message string) string {
+	now := time.Now()
+	ok, rotated, err := s.pairing.tryCode(config.bot, senderID, message, now)
+	if err != nil {
+		log.Printf("[kakao] Failed to save paired users: %v", err)
+	}
+	if rotated {
+		log.Printf("[kakao] Pairing code rotated after %d wrong attempts", maxPairingAttempts)
+	}
+	if ok {
+		log.Printf("[kakao] Paired %s with %s by code", senderID, config.bot)
+		s.emit("kakao:paired", senderID)
+		return pairingDoneText
+	}
+
+	if req, isNew := s.pairing.request(config.bot, senderID, message, now); isNew {
+		log.Printf("[kakao] Pairing request from %s to %s", senderID, config.bot)
+		s.emit("kakao:pairing", req)
+	}
+	return pairingPendingText
+}
+
+// PairingCode returns the current pairing code for display
+func (s *Server) PairingCode() PairingCode {
+	return s.pairing.currentCode(time.Now())
+}
+
+// PairingRequests returns the pending pairing requests, oldest first
+func (s *Server) PairingRequests() []PairingRequest {
+	s.pairing.mu.Lock()
+	defer s.pairing.mu.Unlock()
+
+	requests := make([]PairingRequest, 0, len(s.pairing.pending))
+	for _, req := range s.pairing.pending {
+		if time.Since(req.RequestedAt) <= pairingRequestTTL {
+			requests = append(requests, req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].RequestedAt.Before(requests[j].RequestedAt) })
+	return requests
+}
+
+// ApprovePairing pairs a user with bot, usually one with a pending request
+func (s *Server) ApprovePairing(bot, senderID, displayName string) error {
+	if senderID == "" {
+		return fmt.Errorf("sender ID is required")
+	}
+	if bot == "" {
+		bot = mainBot
+	}
+
+	s.pairing.mu.Lock()
+	err := s.pairing.pairLocked(bot, senderID, displayName, "approval", time.Now())
+	s.pairing.mu.Unlock()
+
+	s.emit("kakao:paired", senderID)
+	return err
+}
+
+// RejectPairing drops a pending request
+func (s *Server) RejectPairing(bot, senderID string) {
+	s.pairing.mu.Lock()
+	defer s.pairing.mu.Unlock()
+	delete(s.pairing.pending, userKey(bot, senderID))
+}
+
+// RevokePairing removes a user paired with bot and their conversation
+func (s *Server) RevokePairing(bot, senderID string) error {
+	s.pairing.mu.Lock()
+	delete(s.pairing.paired, userKey(bot, senderID))
+	err := s.pairing.saveLocked()
+	s.pairing.mu.Unlock()
+
+	s.agent.ClearSession(sessionID(userKey(bot, senderID)))
+	return err
+}
+
+// PairedUsers returns the paired users, oldest first
+func (s *Server) PairedUsers() []PairedUser {
+	s.pairing.mu.Lock()
+	defer s.pairing.mu.Unlock()
+	return s.pairing.listLocked()
+}
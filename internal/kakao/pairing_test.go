@@ -0,0 +1,140 @@
+package kakao
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newPairingServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	dir := t.TempDir()
+	s.SetDataDir(dir)
+	cfg := DefaultConfig()
+	cfg.DMPolicy = "pairing"
+	s.UpdateConfig(cfg)
+	return s, dir
+}
+
+func TestPairingWithCode(t *testing.T) {
+	s, dir := newPairingServer(t)
+
+	var events []string
+	s.SetEventHandler(func(name string, data interface{}) {
+		if name != "kakao:message" {
+			events = append(events, name)
+		}
+	})
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != pairingPendingText {
+		t.Fatalf("unknown user got %q", got)
+	}
+	if reqs := s.PairingRequests(); len(reqs) != 1 || reqs[0].SenderID != "u1" {
+		t.Errorf("requests = %+v", reqs)
+	}
+
+	code := s.PairingCode().Code
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", code), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != pairingDoneText {
+		t.Fatalf("pairing code got %q", got)
+	}
+	if s.PairingCode().Code == code {
+		t.Error("code was not rotated after use")
+	}
+	if len(s.PairingRequests()) != 0 {
+		t.Error("request still pending after pairing")
+	}
+	if len(events) != 2 || events[0] != "kakao:pairing" || events[1] != "kakao:paired" {
+		t.Errorf("events = %v", events)
+	}
+
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got == pairingPendingText {
+		t.Error("paired user still pending")
+	}
+
+	// Paired users survive a restart
+	restarted, _ := newTestServer(t)
+	restarted.SetDataDir(dir)
+	if users := restarted.PairedUsers(); len(users) != 1 || users[0].Method != "code" {
+		t.Errorf("paired users after reload = %+v", users)
+	}
+}
+
+func TestPairingApproveAndRevoke(t *testing.T) {
+	s, _ := newPairingServer(t)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if err := s.ApprovePairing(mainBot, "u1", "김대리"); err != nil {
+		t.Fatal(err)
+	}
+	if users := s.PairedUsers(); len(users) != 1 || users[0].DisplayName != "김대리" {
+		t.Errorf("paired users = %+v", users)
+	}
+
+	if err := s.RevokePairing(mainBot, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != pairingPendingText {
+		t.Errorf("revoked user got %q", got)
+	}
+
+	s.RejectPairing(mainBot, "u1")
+	if len(s.PairingRequests()) != 0 {
+		t.Error("rejected request still pending")
+	}
+}
+
+func TestPairingCodeRotatesAfterFailedAttempts(t *testing.T) {
+	s, _ := newPairingServer(t)
+	code := s.PairingCode().Code
+
+	// Guesses from different users count against the same code
+	for i := 0; i < maxPairingAttempts; i++ {
+		guess := fmt.Sprintf("%06d", i)
+		if guess == code {
+			guess = "999999"
+		}
+		postWebhook(t, s, "/kakao/webhook", userRequest(fmt.Sprintf("attacker%d", i), guess), nil)
+	}
+	if s.PairingCode().Code == code {
+		t.Fatal("code was not rotated after repeated wrong guesses")
+	}
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", code), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != pairingPendingText {
+		t.Errorf("old code still pairs: %q", got)
+	}
+}
+
+func TestPairingIsPerBot(t *testing.T) {
+	s, _ := newPairingServer(t)
+	cfg := twoBotConfig()
+	cfg.DMPolicy = "pairing"
+	cfg.Bots[0].DMPolicy = "pairing"
+	cfg.Bots[0].AllowFrom = []string{}
+	s.UpdateConfig(cfg)
+
+	if err := s.ApprovePairing(mainBot, "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp := postWebhook(t, s, "/kakao/sales", userRequest("u1", "안녕"), nil); resp.Template.Outputs[0].SimpleText.Text != pairingPendingText {
+		t.Errorf("pairing with the main bot admitted u1 to the sales bot: %+v", resp)
+	}
+	if reqs := s.PairingRequests(); len(reqs) != 1 || reqs[0].Bot != "sales" {
+		t.Errorf("requests = %+v", reqs)
+	}
+
+	// The allowlist policy doesn't look at paired users
+	cfg.Bots[0].DMPolicy = "allowlist"
+	cfg.Bots[0].AllowFrom = []string{"s1"}
+	s.UpdateConfig(cfg)
+	if err := s.ApprovePairing("sales", "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp := postWebhook(t, s, "/kakao/sales", userRequest("u1", "안녕"), nil); resp.Template.Outputs[0].SimpleText.Text != "접근이 허용되지 않았습니다." {
+		t.Errorf("paired user passed the allowlist: %+v", resp)
+	}
+}
@@ -0,0 +1,203 @@
+package kakao
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit protects the machine from users flooding the bot
+type RateLimit struct {
+	Enabled bool `json:"enabled"`
+
+	// Token buckets: sustained messages per minute and burst size, per
+	// user and for the bot as a whole. Zero disables a bucket.
+	PerUserPerMinute int `json:"perUserPerMinute"`
+	PerUserBurst     int `json:"perUserBurst"`
+	GlobalPerMinute  int `json:"globalPerMinute"`
+	GlobalBurst      int `json:"globalBurst"`
+
+	DailyQuota         int `json:"dailyQuota"`         // messages per user per day
+	MaxUtteranceLength int `json:"maxUtteranceLength"` // characters
+
+	// Users who exceed their rate BlockAfterViolations times within
+	// violationWindow are blocked for BlockMinutes
+	BlockAfterViolations int `json:"blockAfterViolations"`
+	BlockMinutes         int `json:"blockMinutes"`
+}
+
+// DefaultRateLimit returns the default limits
+func DefaultRateLimit() RateLimit {
+	return RateLimit{
+		Enabled:              true,
+		PerUserPerMinute:     6,
+		PerUserBurst:         3,
+		GlobalPerMinute:      60,
+		GlobalBurst:          10,
+		DailyQuota:           200,
+		MaxUtteranceLength:   1000,
+		BlockAfterViolations: 5,
+		BlockMinutes:         10,
+	}
+}
+
+// violationWindow is how far back violations count towards a block
+const violationWindow = 10 * time.Minute
+
+// limitReason says which limit rejected a message
+type limitReason string
+
+const (
+	limitNone     limitReason = ""
+	limitBlocked  limitReason = "blocked"
+	limitLength   limitReason = "too long"
+	limitQuota    limitReason = "daily quota"
+	limitUserRate limitReason = "user rate"
+	limitGlobal   limitReason = "global rate"
+)
+
+// message returns the reply for a rejected message
+func (r limitReason) message(cfg RateLimit) string {
+	switch r {
+	case limitLength:
+		return fmt.Sprintf("메시지가 너무 깁니다. %d자 이내로 보내 주세요.", cfg.MaxUtteranceLength)
+	case limitQuota:
+		return "오늘 사용 가능한 횟수를 모두 사용했습니다. 내일 다시 이용해 주세요."
+	default:
+		return "잠시 후 다시 시도해 주세요."
+	}
+}
+
+// bucket is a token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last call
+func (b *bucket) refill(now time.Time, perMinute, burst int) {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Minutes() * float64(perMinute)
+	}
+	b.tokens = math.Min(b.tokens, float64(burst))
+	b.last = now
+}
+
+type userLimit struct {
+	bucket       bucket
+	day          string
+	count        int
+	violations   []time.Time
+	blockedUntil time.Time
+	lastSeen     time.Time
+}
+
+// rateLimiter tracks limits for all users of a bot
+type rateLimiter struct {
+	mu     sync.Mutex
+	global bucket
+	users  map[string]*userLimit
+}
+
+// check records a message of length characters from senderID and returns
+// the limit it breaks, if any. Messages are counted for /usage even when
+// limits are disabled. Only known senders draw on the bot's global budget,
+// so strangers can't use it up for everyone else.
+func (l *rateLimiter) check(senderID string, length int, cfg RateLimit, now time.Time, known bool) limitReason {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.users == nil {
+		l.users = make(map[string]*userLimit)
+	}
+	user, ok := l.users[senderID]
+	if !ok {
+		user = &userLimit{}
+		l.users[senderID] = user
+	}
+	user.lastSeen = now
+	if day := now.Format("2006-01-02"); user.day != day {
+		user.day, user.count = day, 0
+	}
+
+	if !cfg.Enabled {
+		user.count++
+		return limitNone
+	}
+
+	if now.Before(user.blockedUntil) {
+		return limitBlocked
+	}
+	if cfg.MaxUtteranceLength > 0 && length > cfg.MaxUtteranceLength {
+		return limitLength
+	}
+	if cfg.DailyQuota > 0 && user.count >= cfg.DailyQuota {
+		return limitQuota
+	}
+
+	userBucket := cfg.PerUserPerMinute > 0 && cfg.PerUserBurst > 0
+	if userBucket {
+		user.bucket.refill(now, cfg.PerUserPerMinute, cfg.PerUserBurst)
+		if user.bucket.tokens < 1 {
+			l.violate(user, cfg, now)
+			return limitUserRate
+		}
+	}
+
+	globalBucket := known && cfg.GlobalPerMinute > 0 && cfg.GlobalBurst > 0
+	if globalBucket {
+		l.global.refill(now, cfg.GlobalPerMinute, cfg.GlobalBurst)
+		if l.global.tokens < 1 {
+			return limitGlobal
+		}
+		l.global.tokens--
+	}
+	if userBucket {
+		user.bucket.tokens--
+	}
+	user.count++
+	return limitNone
+}
+
+// violate records a rate violation and blocks the user after too many
+func (l *rateLimiter) violate(user *userLimit, cfg RateLimit, now time.Time) {
+	recent := user.violations[:0]
+	for _, t := range user.violations {
+		if now.Sub(t) < violationWindow {
+			recent = append(recent, t)
+		}
+	}
+	user.violations = append(recent, now)
+
+	if cfg.BlockAfterViolations > 0 && len(user.violations) >= cfg.BlockAfterViolations {
+		user.blockedUntil = now.Add(time.Duration(cfg.BlockMinutes) * time.Minute)
+		user.violations = nil
+	}
+}
+
+// todayCount returns how many messages senderID sent today
+func (l *rateLimiter) todayCount(senderID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	user, ok := l.users[senderID]
+	if !ok || user.day != time.Now().Format("2006-01-02") {
+		return 0
+	}
+	return user.count
+}
+
+// prune forgets users not seen for a day
+func (l *rateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, user := range l.users {
+		if now.Sub(user.lastSeen) > 24*time.Hour && now.After(user.blockedUntil) {
+			delete(l.users, id)
+		}
+	}
+}
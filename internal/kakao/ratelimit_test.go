@@ -0,0 +1,111 @@
+package kakao
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitUserBucket(t *testing.T) {
+	var l rateLimiter
+	cfg := RateLimit{Enabled: true, PerUserPerMinute: 6, PerUserBurst: 2}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if r := l.check("u1", 1, cfg, now, true); r != limitNone {
+			t.Fatalf("message %d limited: %s", i, r)
+		}
+	}
+	if r := l.check("u1", 1, cfg, now, true); r != limitUserRate {
+		t.Errorf("burst exceeded: got %q", r)
+	}
+	if r := l.check("u2", 1, cfg, now, true); r != limitNone {
+		t.Errorf("other user limited: %s", r)
+	}
+	// 6 per minute refills one token every 10 seconds
+	if r := l.check("u1", 1, cfg, now.Add(10*time.Second), true); r != limitNone {
+		t.Errorf("after refill: got %q", r)
+	}
+}
+
+func TestRateLimitGlobalBucket(t *testing.T) {
+	var l rateLimiter
+	cfg := RateLimit{Enabled: true, GlobalPerMinute: 60, GlobalBurst: 2}
+	now := time.Now()
+
+	l.check("u1", 1, cfg, now, true)
+	l.check("u2", 1, cfg, now, true)
+	if r := l.check("u3", 1, cfg, now, true); r != limitGlobal {
+		t.Errorf("got %q, want global limit", r)
+	}
+}
+
+func TestRateLimitQuotaAndLength(t *testing.T) {
+	var l rateLimiter
+	cfg := RateLimit{Enabled: true, DailyQuota: 2, MaxUtteranceLength: 10}
+	now := time.Date(2026, 1, 1, 23, 0, 0, 0, time.Local)
+
+	if r := l.check("u1", 11, cfg, now, true); r != limitLength {
+		t.Errorf("long message: got %q", r)
+	}
+	l.check("u1", 1, cfg, now, true)
+	l.check("u1", 1, cfg, now, true)
+	if r := l.check("u1", 1, cfg, now, true); r != limitQuota {
+		t.Errorf("over quota: got %q", r)
+	}
+	if r := l.check("u1", 1, cfg, now.Add(2*time.Hour), true); r != limitNone {
+		t.Errorf("next day: got %q", r)
+	}
+}
+
+func TestRateLimitBlocksRepeatOffenders(t *testing.T) {
+	var l rateLimiter
+	cfg := RateLimit{Enabled: true, PerUserPerMinute: 1, PerUserBurst: 1, BlockAfterViolations: 3, BlockMinutes: 10}
+	now := time.Now()
+
+	l.check("u1", 1, cfg, now, true)
+	for i := 0; i < 3; i++ {
+		l.check("u1", 1, cfg, now, true)
+	}
+	// Long after the bucket refilled the user is still blocked
+	if r := l.check("u1", 1, cfg, now.Add(5*time.Minute), true); r != limitBlocked {
+		t.Errorf("got %q, want blocked", r)
+	}
+	if r := l.check("u1", 1, cfg, now.Add(11*time.Minute), true); r != limitNone {
+		t.Errorf("after block: got %q", r)
+	}
+}
+
+func TestWebhookRateLimited(t *testing.T) {
+	s, srv := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.RateLimit = RateLimit{Enabled: true, PerUserPerMinute: 1, PerUserBurst: 1}
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; !strings.Contains(got, "잠시 후 다시 시도해 주세요") {
+		t.Errorf("limited reply = %q", got)
+	}
+	if n := len(srv.ChatRequests()); n != 1 {
+		t.Errorf("%d LLM calls, want 1", n)
+	}
+}
+
+func TestWebhookStrangersSpareGlobalBudget(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	cfg := DefaultConfig()
+	cfg.DMPolicy = "allowlist"
+	cfg.AllowFrom = []string{"u1"}
+	cfg.RateLimit = RateLimit{Enabled: true, PerUserPerMinute: 1, PerUserBurst: 1, GlobalPerMinute: 1, GlobalBurst: 1}
+	s.UpdateConfig(cfg)
+
+	for _, id := range []string{"x1", "x2", "x3"} {
+		postWebhook(t, s, "/kakao/webhook", userRequest(id, "안녕"), nil)
+	}
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "네" {
+		t.Errorf("allowed user got %q", got)
+	}
+}
@@ -0,0 +1,177 @@
+package kakao
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testClient does not keep connections around for Shutdown to wait on
+var testClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func healthy(port int) bool {
+	resp, err := testClient.Get(fmt.Sprintf("http://127.0.0.1:%d/health", port))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func startedServer(t *testing.T) (*Server, *Config) {
+	t.Helper()
+	s, _ := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s, cfg
+}
+
+func TestUpdateConfigRebindsPort(t *testing.T) {
+	s, cfg := startedServer(t)
+	oldPort := cfg.Port
+
+	next := *cfg
+	next.Port = freePort(t)
+	if err := s.UpdateConfig(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	if !healthy(next.Port) {
+		t.Error("new port not serving")
+	}
+	if healthy(oldPort) {
+		t.Error("old port still serving")
+	}
+}
+
+func TestUpdateConfigKeepsOldPortOnBindError(t *testing.T) {
+	s, cfg := startedServer(t)
+
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	next := *cfg
+	next.Port = busy.Addr().(*net.TCPAddr).Port
+	next.SystemPrompt = "바뀐 프롬프트"
+	if err := s.UpdateConfig(&next); err == nil {
+		t.Fatal("expected bind error")
+	}
+
+	if got := s.GetConfig(); got.Port != cfg.Port || got.SystemPrompt == "바뀐 프롬프트" {
+		t.Errorf("config changed despite error: %+v", got)
+	}
+	if !healthy(cfg.Port) {
+		t.Error("old port stopped serving")
+	}
+}
+
+func TestUpdateConfigFollowsEnabled(t *testing.T) {
+	s, cfg := startedServer(t)
+
+	off := *cfg
+	off.Enabled = false
+	s.UpdateConfig(&off)
+	if s.IsRunning() || healthy(cfg.Port) {
+		t.Error("server still running after disable")
+	}
+
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsRunning() || !healthy(cfg.Port) {
+		t.Error("server not restarted after enable")
+	}
+}
+
+func TestUpdateConfigSwapsWebhookPath(t *testing.T) {
+	s, cfg := startedServer(t)
+
+	next := *cfg
+	next.WebhookPath = "/kakao/v2"
+	if err := s.UpdateConfig(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path string) int {
+		resp, err := testClient.Post(fmt.Sprintf("http://127.0.0.1:%d%s", cfg.Port, path), "application/json",
+			strings.NewReader(`{"userRequest":{"utterance":"/help","user":{"id":"u1"}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("/kakao/v2"); code != http.StatusOK {
+		t.Errorf("new path status = %d", code)
+	}
+	if code := post("/kakao/webhook"); code != http.StatusNotFound {
+		t.Errorf("old path status = %d", code)
+	}
+}
+
+func TestUpdateConfigRejectsDuplicatePaths(t *testing.T) {
+	s, _ := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.Bots = []Bot{{Name: "sales", WebhookPath: cfg.WebhookPath}}
+
+	if err := s.UpdateConfig(cfg); err == nil {
+		t.Error("duplicate webhook path accepted")
+	}
+}
+
+func TestUpdateConfigEnableStartsStoppedServer(t *testing.T) {
+	s, cfg := startedServer(t)
+	s.Stop()
+
+	off := *cfg
+	off.Enabled = false
+	off.Port = 0 // not checked while disabled
+	if err := s.UpdateConfig(&off); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UpdateConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsRunning() || !healthy(cfg.Port) {
+		t.Error("server not started when enabled after Stop")
+	}
+}
+
+func TestUpdateConfigValidatesRoutes(t *testing.T) {
+	s, _ := newTestServer(t)
+	for name, route := range map[string]Route{
+		"unknown type":     {BlockID: "b1", Type: "script"},
+		"unknown tool":     {BlockID: "b1", Type: RouteTool, Tool: "missing"},
+		"invalid template": {BlockID: "b1", Type: RoutePrompt, Prompt: "{{.Utterance"},
+		"no block":         {Type: RouteAgent},
+	} {
+		cfg := DefaultConfig()
+		cfg.Routes = []Route{route}
+		if err := s.UpdateConfig(cfg); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package kakao
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// Route types
+const (
+	RouteTool   = "tool"
+	RoutePrompt = "prompt"
+	RouteAgent  = "agent"
+)
+
+// Route sends an Open Builder block to a handler. A route matches by block
+// ID, or by block name if no ID is given.
+type Route struct {
+	BlockID   string `json:"blockId,omitempty"`
+	BlockName string `json:"blockName,omitempty"`
+	Type      string `json:"type"` // "tool", "prompt" or "agent"
+
+	// Tool is called with the action params as arguments. Args maps tool
+	// argument names to action param names; without it every param is
+	// passed under its own name.
+	Tool string            `json:"tool,omitempty"`
+	Args map[string]string `json:"args,omitempty"`
+
+	// Prompt is a text/template rendered with .Utterance, .Params and
+	// .SenderID and sent to the agent in place of the utterance
+	Prompt string `json:"prompt,omitempty"`
+
+	// Profile selects the persona for prompt and agent routes
+	Profile string `json:"profile,omitempty"`
+}
+
+func (r Route) key() string {
+	if r.BlockID != "" {
+		return r.BlockID
+	}
+	return r.BlockName
+}
+
+// validate checks that the route can match a block and be handled
+func (r Route) validate() error {
+	if r.key() == "" {
+		return fmt.Errorf("route needs a block ID or name")
+	}
+	switch r.Type {
+	case RouteTool:
+		if r.Tool == "" {
+			return fmt.Errorf("route %s: tool is required", r.key())
+		}
+	case RoutePrompt:
+		if _, err := template.New(r.key()).Parse(r.Prompt); err != nil {
+			return fmt.Errorf("route %s: invalid prompt template: %w", r.key(), err)
+		}
+	case RouteAgent:
+	default:
+		return fmt.Errorf("route %s: unknown type %q", r.key(), r.Type)
+	}
+	return nil
+}
+
+// findRoute returns the route for a block, preferring an ID match
+func findRoute(config *Config, block *KakaoBlock) *Route {
+	if block == nil {
+		return nil
+	}
+	for i, r := range config.Routes {
+		if r.BlockID != "" && r.BlockID == block.ID {
+			return &config.Routes[i]
+		}
+	}
+	for i, r := range config.Routes {
+		if r.BlockID == "" && r.BlockName != "" && r.BlockName == block.Name {
+			return &config.Routes[i]
+		}
+	}
+	return nil
+}
+
+// PromptData is available to route prompt templates
+type PromptData struct {
+	Utterance string
+	SenderID  string
+	Params    map[string]interface{}
+}
+
+// actionParams returns the action params, preferring detailed values and
+// decoding values that are JSON objects (e.g. sys.date entities)
+func actionParams(action *KakaoAction) map[string]interface{} {
+	params := make(map[string]interface{})
+	if action == nil {
+		return params
+	}
+
+	for name, value := range action.Params {
+		params[name] = value
+	}
+	for name, detail := range action.DetailParams {
+		if detail.Value != "" {
+			params[name] = detail.Value
+		}
+	}
+
+	for name, value := range params {
+		text, _ := value.(string)
+		if strings.HasPrefix(strings.TrimSpace(text), "{") {
+			var obj map[string]interface{}
+			if json.Unmarshal([]byte(text), &obj) == nil {
+				params[name] = obj
+			}
+		}
+	}
+	return params
+}
+
+// runRoute handles a message with the route's handler
+func (s *Server) runRoute(ctx context.Context, config *Config, route Route, senderID, message string, action *KakaoAction) answer {
+	params := actionParams(action)
+
+	switch route.Type {
+	case RouteTool:
+		args := params
+		if len(route.Args) > 0 {
+			args = make(map[string]interface{}, len(route.Args))
+			for arg, param := range route.Args {
+				if v, ok := params[param]; ok {
+					args[arg] = v
+				}
+			}
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer s.track(config.userKey(senderID), cancel)()
+
+		result, err := s.agent.RunTool(ctx, route.Tool, args)
+		if err != nil {
+			log.Printf("[kakao] Route tool %s failed: %v", route.Tool, err)
+			return answer{text: fmt.Sprintf("요청을 처리하지 못했습니다: %v", err), err: err}
+		}
+		return answer{text: result}
+
+	case RoutePrompt:
+		tmpl, err := template.New(route.key()).Parse(route.Prompt)
+		if err != nil {
+			log.Printf("[kakao] Invalid prompt template for %s: %v", route.key(), err)
+			return answer{text: "블록 설정이 올바르지 않습니다.", err: err}
+		}
+		var buf bytes.Buffer
+		data := PromptData{Utterance: message, SenderID: senderID, Params: params}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			log.Printf("[kakao] Prompt template for %s failed: %v", route.key(), err)
+			return answer{text: "블록 설정이 올바르지 않습니다.", err: err}
+		}
+		return s.ask(ctx, config, senderID, buf.String(), route.Profile)
+
+	default:
+		return s.ask(ctx, config, senderID, message, route.Profile)
+	}
+}
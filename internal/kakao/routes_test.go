@@ -0,0 +1,107 @@
+package kakao
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"DubaiCrab/internal/agent"
+	"DubaiCrab/internal/ollama"
+	"DubaiCrab/internal/ollama/ollamatest"
+	"DubaiCrab/internal/tools"
+)
+
+type echoTool struct{}
+
+func (echoTool) Name() string                   { return "echo" }
+func (echoTool) Description() string            { return "returns its arguments" }
+func (echoTool) Schema() map[string]interface{} { return nil }
+func (echoTool) Execute(ctx context.Context, params map[string]interface{}) (string, error) {
+	data, _ := json.Marshal(params)
+	return string(data), nil
+}
+
+func blockRequest(userID, utterance, blockID, blockName string, params map[string]string) KakaoRequest {
+	req := userRequest(userID, utterance)
+	req.UserRequest.Block = &KakaoBlock{ID: blockID, Name: blockName}
+	req.Action = &KakaoAction{Params: params}
+	return req
+}
+
+func TestRouteToTool(t *testing.T) {
+	srv := ollamatest.NewServer()
+	t.Cleanup(srv.Close)
+	m := ollama.NewManager()
+	m.SetBaseURL(srv.URL)
+	registry := tools.NewRegistry()
+	registry.Register(echoTool{})
+	s := NewServer(m, agent.NewAgent(m, registry))
+
+	cfg := DefaultConfig()
+	cfg.Routes = []Route{{
+		BlockID: "block-date",
+		Type:    RouteTool,
+		Tool:    "echo",
+		Args:    map[string]string{"when": "date"},
+	}}
+	s.UpdateConfig(cfg)
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", blockRequest("u1", "내일 일정", "block-date", "", map[string]string{
+		"date":  `{"value":"2026-10-19","userTimeZone":"UTC+9"}`,
+		"other": "ignored",
+	}), nil)
+	got := resp.Template.Outputs[0].SimpleText.Text
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(got), &args); err != nil {
+		t.Fatalf("tool output %q: %v", got, err)
+	}
+	when, ok := args["when"].(map[string]interface{})
+	if !ok || when["value"] != "2026-10-19" {
+		t.Errorf("date param not passed as object: %v", args)
+	}
+	if _, ok := args["other"]; ok {
+		t.Errorf("unmapped param passed: %v", args)
+	}
+	if n := len(srv.ChatRequests()); n != 0 {
+		t.Errorf("tool route called the LLM %d times", n)
+	}
+}
+
+func TestRouteToPrompt(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("확인했습니다")
+	cfg := DefaultConfig()
+	cfg.Routes = []Route{{
+		BlockName: "휴가 신청",
+		Type:      RoutePrompt,
+		Prompt:    "{{.Params.days}}일 휴가 신청서를 작성해 주세요. 원문: {{.Utterance}}",
+	}}
+	s.UpdateConfig(cfg)
+
+	postWebhook(t, s, "/kakao/webhook", blockRequest("u1", "휴가 쓸래요", "unknown", "휴가 신청", map[string]string{"days": "3"}), nil)
+
+	reqs := srv.ChatRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("chat requests = %d", len(reqs))
+	}
+	msgs := reqs[0].Messages
+	want := "3일 휴가 신청서를 작성해 주세요. 원문: 휴가 쓸래요"
+	if last := msgs[len(msgs)-1].Content; !strings.Contains(last, want) {
+		t.Errorf("prompt = %q, want %q", last, want)
+	}
+}
+
+func TestUnroutedBlockUsesAgent(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("일반 답변")
+	cfg := DefaultConfig()
+	cfg.Routes = []Route{{BlockID: "other", Type: RoutePrompt, Prompt: "{{.Utterance}}"}}
+	s.UpdateConfig(cfg)
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", blockRequest("u1", "안녕", "fallback", "", nil), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "일반 답변" {
+		t.Errorf("reply = %q", got)
+	}
+}
@@ -3,13 +3,18 @@ package kakao
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"DubaiCrab/internal/agent"
 	"DubaiCrab/internal/ollama"
 )
 
@@ -18,31 +23,141 @@ type Config struct {
 	Enabled      bool     `json:"enabled"`
 	Port         int      `json:"port"`
 	WebhookPath  string   `json:"webhookPath"`
-	DMPolicy     string   `json:"dmPolicy"` // "open", "allowlist", "disabled"
+	DMPolicy     string   `json:"dmPolicy"` // "open", "allowlist", "pairing", "disabled"
 	AllowFrom    []string `json:"allowFrom"`
 	SystemPrompt string   `json:"systemPrompt"`
 	Model        string   `json:"model"`
+
+	// AllowedTools lists the agent tools the bot may call; empty allows none
+	AllowedTools []string `json:"allowedTools"`
+	// SessionIdleMinutes expires a user's conversation after inactivity
+	SessionIdleMinutes int `json:"sessionIdleMinutes"`
+	// Optional webhook verification: a shared secret sent in SecretHeader
+	// or the "token" query parameter, allowed source IPs or CIDR ranges, and
+	// the bot ID requests must carry. Empty values disable each check.
+	WebhookSecret     string   `json:"webhookSecret"`
+	AllowedIPs        []string `json:"allowedIps"`
+	TrustForwardedFor bool     `json:"trustForwardedFor"` // behind a proxy or tunnel
+	BotID             string   `json:"botId"`
+
+	RateLimit RateLimit `json:"rateLimit"`
+
+	// Chat commands: Admins may run admin-only commands, AllowedModels are
+	// the models /model may switch to, Profiles are the personas /profile
+	// may switch to, and CommandPermissions overrides a command's
+	// permission ("everyone", "admin" or "disabled")
+	Admins             []string           `json:"admins"`
+	AllowedModels      []string           `json:"allowedModels"`
+	Profiles           map[string]Profile `json:"profiles"`
+	CommandPermissions map[string]string  `json:"commandPermissions"`
+
+	// Bots are further Open Builder bots served on the same port, each under
+	// its own webhook path
+	Bots []Bot `json:"bots"`
+
+	// Routes send Open Builder blocks to a tool, a prompt template or the
+	// agent instead of the general conversation
+	Routes []Route `json:"routes"`
+
+	// Attachments downloads images and documents sent with a message and
+	// passes their text (OCR or HWP parsing) to the agent
+	Attachments     bool `json:"attachments"`
+	MaxAttachmentMB int  `json:"maxAttachmentMb"`
+
+	// ConversationLog keeps every exchange on disk for LogRetentionDays
+	// (0 keeps them forever)
+	ConversationLog  bool `json:"conversationLog"`
+	LogRetentionDays int  `json:"logRetentionDays"`
+
+	// RichReplies lets the agent answer with cards, lists and quick replies
+	RichReplies bool `json:"richReplies"`
+	// ReplyTimeoutMs is how long a skill request waits for the LLM before
+	// falling back to a callback or a "try again" reply
+	ReplyTimeoutMs int `json:"replyTimeoutMs"`
+
+	// bot names the bot a request-scoped copy belongs to
+	bot string
+	// simulated marks a request-scoped copy serving a simulator request
+	simulated bool
 }
 
 // DefaultConfig returns default configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Enabled:      true,
-		Port:         3847,
-		WebhookPath:  "/kakao/webhook",
-		DMPolicy:     "open",
-		AllowFrom:    []string{},
-		SystemPrompt: "당신은 Dubai Crab, 한국 사무직을 위한 친절한 AI 비서입니다. 간결하고 도움이 되는 답변을 제공하세요.",
-		Model:        "qwen2.5:0.5b",
+		Enabled:            true,
+		Port:               3847,
+		WebhookPath:        "/kakao/webhook",
+		DMPolicy:           "open",
+		AllowFrom:          []string{},
+		SystemPrompt:       "당신은 Dubai Crab, 한국 사무직을 위한 친절한 AI 비서입니다. 간결하고 도움이 되는 답변을 제공하세요.",
+		Model:              "qwen2.5:0.5b",
+		AllowedTools:       []string{},
+		SessionIdleMinutes: 30,
+		AllowedIPs:         []string{},
+		RateLimit:          DefaultRateLimit(),
+		Admins:             []string{},
+		AllowedModels:      []string{},
+		Profiles:           map[string]Profile{},
+		CommandPermissions: map[string]string{},
+		Bots:               []Bot{},
+		Routes:             []Route{},
+		Attachments:        true,
+		MaxAttachmentMB:    defaultMaxAttachmentMB,
+		ConversationLog:    true,
+		LogRetentionDays:   30,
+		RichReplies:        true,
+		ReplyTimeoutMs:     4500,
+	}
+}
+
+// sessionPrefix namespaces Kakao conversations in the shared agent
+const sessionPrefix = "kakao:"
+
+// userKey identifies a user of one bot. Per-user state is kept per bot, so
+// someone talking to two bots has a separate conversation with each.
+func userKey(bot, senderID string) string {
+	if bot == "" {
+		bot = mainBot
 	}
+	return bot + ":" + senderID
+}
+
+// userKey returns the key of senderID on the bot of a request-scoped
+// config. Simulator requests get keys of their own, so trying a bot out
+// never touches a real user's conversation.
+func (c *Config) userKey(senderID string) string {
+	key := userKey(c.bot, senderID)
+	if c.simulated {
+		key = simulatorUserID + ":" + key
+	}
+	return key
+}
+
+// sessionID returns the agent session for a user key
+func sessionID(key string) string {
+	return sessionPrefix + key
 }
 
+// State is a step in the webhook server's lifecycle
+type State string
+
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateStopping State = "stopping"
+	StateFailed   State = "failed"
+)
+
 // Status represents server status
 type Status struct {
-	Running     bool   `json:"running"`
-	Enabled     bool   `json:"enabled"`
-	Port        int    `json:"port"`
-	WebhookPath string `json:"webhookPath"`
+	State       State       `json:"state"`
+	Error       string      `json:"error,omitempty"` // why the server failed
+	Running     bool        `json:"running"`
+	Enabled     bool        `json:"enabled"`
+	Port        int         `json:"port"`
+	WebhookPath string      `json:"webhookPath"`
+	Bots        []BotStatus `json:"bots"`
 }
 
 // KakaoBot represents bot info
@@ -75,86 +190,205 @@ type KakaoUserRequest struct {
 	Block       *KakaoBlock `json:"block,omitempty"`
 }
 
+// KakaoDetailParam is the detailed value of an action parameter
+type KakaoDetailParam struct {
+	Origin    string `json:"origin,omitempty"`
+	Value     string `json:"value,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
+}
+
+// KakaoAction is the skill action with the parameters Open Builder
+// extracted from the utterance
+type KakaoAction struct {
+	ID           string                      `json:"id,omitempty"`
+	Name         string                      `json:"name,omitempty"`
+	Params       map[string]string           `json:"params,omitempty"`
+	DetailParams map[string]KakaoDetailParam `json:"detailParams,omitempty"`
+	ClientExtra  map[string]interface{}      `json:"clientExtra,omitempty"`
+}
+
 // KakaoRequest represents incoming webhook request
 type KakaoRequest struct {
 	Bot         *KakaoBot         `json:"bot,omitempty"`
 	UserRequest *KakaoUserRequest `json:"userRequest,omitempty"`
+	Action      *KakaoAction      `json:"action,omitempty"`
 }
 
-// SimpleText represents simple text output
-type SimpleText struct {
-	Text string `json:"text"`
+// Server handles Kakao webhook requests
+type Server struct {
+	ollama   *ollama.Manager
+	agent    *agent.Agent
+	config   *Config
+	server   *http.Server
+	listener net.Listener // of server; closed on stop to free the port at once
+	state    State
+	stateErr string
+	managed  bool // Start was called; config updates start and stop the server
+	mu       sync.RWMutex
+	cancelFn context.CancelFunc
+
+	transitions []Status // state changes not yet published
+
+	client *http.Client // for callbacks
+	files  *http.Client // for attachments
+
+	simulatorToken string // marks requests sent by Simulate
+
+	late          lateReplies
+	pages         pageStore
+	deadLetters   jsonlLog
+	audit         jsonlLog
+	bots          botState
+	conversations conversationLog
+	inbox         inbox
+	pairing       pairing
+	commands      commandState
+
+	eventMu sync.RWMutex
+	onEvent EventFunc
 }
 
-// KakaoOutput represents output wrapper
-type KakaoOutput struct {
-	SimpleText SimpleText `json:"simpleText"`
-}
+// NewServer creates a new Kakao webhook server. Messages go through the
+// agent with one session per Kakao user.
+func NewServer(ollamaManager *ollama.Manager, ag *agent.Agent) *Server {
+	s := &Server{
+		ollama: ollamaManager,
+		agent:  ag,
+		config: DefaultConfig(),
+		client: &http.Client{Timeout: 10 * time.Second},
+		files:  newAttachmentClient(),
+		audit:  jsonlLog{maxBytes: auditLogMaxBytes},
 
-// KakaoTemplate represents response template
-type KakaoTemplate struct {
-	Outputs []KakaoOutput `json:"outputs"`
+		simulatorToken: newSimulatorToken(),
+	}
+	s.registerBuiltinCommands()
+	return s
 }
 
-// KakaoData represents callback data
-type KakaoData struct {
-	Text string `json:"text,omitempty"`
+// SetDataDir sets where the server keeps its logs; without it nothing is
+// persisted
+func (s *Server) SetDataDir(dir string) {
+	s.deadLetters.setPath(filepath.Join(dir, "callback_dead_letters.jsonl"))
+	s.audit.setPath(filepath.Join(dir, "webhook_audit.jsonl"))
+	s.conversations.setDir(filepath.Join(dir, "conversations"))
+	if err := s.pairing.load(filepath.Join(dir, "paired_users.json")); err != nil {
+		log.Printf("[kakao] Failed to load paired users: %v", err)
+	}
 }
 
-// KakaoResponse represents webhook response
-type KakaoResponse struct {
-	Version     string         `json:"version"`
-	UseCallback *bool          `json:"useCallback,omitempty"`
-	Template    KakaoTemplate  `json:"template"`
-	Data        *KakaoData     `json:"data,omitempty"`
+// SetEventHandler sets the function that receives server events
+func (s *Server) SetEventHandler(fn EventFunc) {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	s.onEvent = fn
 }
 
-// NewSimpleTextResponse creates a simple text response
-func NewSimpleTextResponse(text string) *KakaoResponse {
-	return &KakaoResponse{
-		Version: "2.0",
-		Template: KakaoTemplate{
-			Outputs: []KakaoOutput{
-				{SimpleText: SimpleText{Text: text}},
-			},
-		},
+func (s *Server) emit(name string, data interface{}) {
+	s.eventMu.RLock()
+	fn := s.onEvent
+	s.eventMu.RUnlock()
+	if fn != nil {
+		fn(name, data)
 	}
 }
 
-// NewCallbackInitialResponse creates initial callback response
-func NewCallbackInitialResponse() *KakaoResponse {
-	useCallback := true
-	return &KakaoResponse{
-		Version:     "2.0",
-		UseCallback: &useCallback,
-		Template:    KakaoTemplate{Outputs: []KakaoOutput{}},
-		Data:        &KakaoData{Text: "처리중입니다..."},
+// validate checks the settings that would break the listener or routing
+func (c *Config) validate() error {
+	if c.Enabled && (c.Port < 1 || c.Port > 65535) {
+		return fmt.Errorf("invalid port: %d", c.Port)
 	}
-}
 
-// Server handles Kakao webhook requests
-type Server struct {
-	ollama    *ollama.Manager
-	config    *Config
-	server    *http.Server
-	running   bool
-	mu        sync.RWMutex
-	cancelFn  context.CancelFunc
-}
+	paths := map[string]string{"/health": "health check"}
+	check := func(name, path string) error {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("webhook path of %s must start with /: %q", name, path)
+		}
+		if other, ok := paths[path]; ok {
+			return fmt.Errorf("webhook path %s of %s is already used by %s", path, name, other)
+		}
+		paths[path] = name
+		return nil
+	}
 
-// NewServer creates a new Kakao webhook server
-func NewServer(ollamaManager *ollama.Manager) *Server {
-	return &Server{
-		ollama: ollamaManager,
-		config: DefaultConfig(),
+	if err := check(mainBot, c.WebhookPath); err != nil {
+		return err
+	}
+	for _, b := range c.Bots {
+		if b.Name == "" || b.Name == mainBot {
+			return fmt.Errorf("bot name %q is reserved or empty", b.Name)
+		}
+		if err := check(b.Name, b.WebhookPath); err != nil {
+			return err
+		}
 	}
+	for _, r := range c.Routes {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// UpdateConfig updates the server configuration
-func (s *Server) UpdateConfig(config *Config) {
+// UpdateConfig applies a new configuration. Once the server has been
+// started it follows the settings: it stops or starts on Enabled and moves
+// to a new port, binding it before the old listener is closed. Turning
+// Enabled on starts a server that was never started or was stopped. On
+// error the previous configuration stays in effect.
+func (s *Server) UpdateConfig(config *Config) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	for _, r := range config.Routes {
+		if r.Type == RouteTool && !s.agent.HasTool(r.Tool) {
+			return fmt.Errorf("route %s: unknown tool %q", r.key(), r.Tool)
+		}
+	}
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+
+	old := s.config
+	switch {
+	case !s.managed:
+		// Not started yet or stopped; Start picks the settings up unless
+		// this update turns the server on
+		if config.Enabled && !old.Enabled {
+			s.config = config
+			s.managed = true
+			if err := s.startLocked(); err != nil {
+				s.config = old
+				s.managed = false
+				return err
+			}
+		}
+	case !config.Enabled:
+		if s.state == StateRunning {
+			s.stopLocked()
+		}
+	case s.state != StateRunning:
+		s.config = config
+		if err := s.startLocked(); err != nil {
+			s.config = old
+			return err
+		}
+	case config.Port != old.Port:
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
+		if err != nil {
+			return fmt.Errorf("failed to listen on port %d: %w", config.Port, err)
+		}
+		prev := s.server
+		s.serveLocked(ln)
+		go shutdown(prev)
+		log.Printf("[kakao] Webhook server moved from port %d to %d", old.Port, config.Port)
+	}
+
+	// Webhook paths, bots and routes are looked up per request, so swapping
+	// the config switches them over at once
 	s.config = config
+	if s.managed {
+		s.setStateLocked(s.state, s.stateErr) // publish the new port and paths
+	}
+	return nil
 }
 
 // GetConfig returns current configuration
@@ -168,27 +402,45 @@ func (s *Server) GetConfig() *Config {
 func (s *Server) IsRunning() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.running
+	return s.state == StateRunning
 }
 
 // GetStatus returns server status
 func (s *Server) GetStatus() Status {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.statusLocked()
+}
+
+func (s *Server) statusLocked() Status {
+	main, _ := s.config.botFor(s.config.WebhookPath)
+	bots := []BotStatus{s.bots.status(main)}
+	for _, b := range s.config.Bots {
+		bots = append(bots, s.bots.status(s.config.forBot(b)))
+	}
+	state := s.state
+	if state == "" {
+		state = StateStopped
+	}
 	return Status{
-		Running:     s.running,
+		State:       state,
+		Error:       s.stateErr,
+		Running:     state == StateRunning,
 		Enabled:     s.config.Enabled,
 		Port:        s.config.Port,
 		WebhookPath: s.config.WebhookPath,
+		Bots:        bots,
 	}
 }
 
-// Start starts the webhook server
+// Start starts the webhook server if it is enabled; from then on config
+// updates start and stop it
 func (s *Server) Start() error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
-	if s.running {
+	s.managed = true
+	if s.state == StateRunning {
 		return nil
 	}
 
@@ -197,63 +449,136 @@ func (s *Server) Start() error {
 		return nil
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc(s.config.WebhookPath, s.handleWebhook)
-	mux.HandleFunc("/health", s.handleHealth)
+	return s.startLocked()
+}
 
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	s.server = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+// startLocked binds the configured port and starts serving
+func (s *Server) startLocked() error {
+	s.setStateLocked(StateStarting, "")
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.Port))
+	if err != nil {
+		err = fmt.Errorf("failed to listen on port %d: %w", s.config.Port, err)
+		s.setStateLocked(StateFailed, err.Error())
+		return err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	s.cancelFn = cancel
+	s.serveLocked(ln)
+	s.setStateLocked(StateRunning, "")
+
+	go s.janitor(ctx)
+
+	log.Printf("[kakao] Webhook server started on http://0.0.0.0:%d%s", s.config.Port, s.config.WebhookPath)
+	return nil
+}
+
+// serveLocked serves webhooks on ln, replacing the current http.Server
+func (s *Server) serveLocked(ln net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/", s.handleWebhook) // dispatched to bots by path
+
+	ln = &onceCloseListener{Listener: ln}
+	srv := &http.Server{Handler: mux}
+	s.server = srv
+	s.listener = ln
 
 	go func() {
-		log.Printf("[kakao] Starting webhook server on %s%s", addr, s.config.WebhookPath)
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("[kakao] Server error: %v", err)
+		err := srv.Serve(ln)
+		if err == nil || err == http.ErrServerClosed {
+			return
 		}
 		s.mu.Lock()
-		s.running = false
-		s.mu.Unlock()
+		defer s.unlock()
+		if s.server != srv {
+			return // stopped or replaced
+		}
+		log.Printf("[kakao] Server error: %v", err)
+		if s.cancelFn != nil {
+			s.cancelFn()
+		}
+		s.server = nil
+		s.setStateLocked(StateFailed, err.Error())
 	}()
+}
 
-	// Wait for server to start
-	time.Sleep(100 * time.Millisecond)
-	s.running = true
-	
-	go func() {
-		<-ctx.Done()
-	}()
+// onceCloseListener lets a listener be closed before http.Server.Shutdown
+// closes it again
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
 
-	log.Printf("[kakao] Webhook server started on http://0.0.0.0%s%s", addr, s.config.WebhookPath)
-	return nil
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() { l.err = l.Listener.Close() })
+	return l.err
 }
 
-// Stop stops the webhook server
+// Stop stops the webhook server until the next Start
 func (s *Server) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.running || s.server == nil {
-		return
+	defer s.unlock()
+
+	s.managed = false
+	switch s.state {
+	case StateRunning:
+		s.stopLocked()
+	case StateFailed:
+		s.setStateLocked(StateStopped, "")
 	}
+}
 
+func (s *Server) stopLocked() {
+	s.setStateLocked(StateStopping, "")
 	if s.cancelFn != nil {
 		s.cancelFn()
 	}
+	// Free the port now and let in-flight requests finish without holding
+	// s.mu
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	go shutdown(s.server)
+	s.server = nil
+	s.listener = nil
+	s.setStateLocked(StateStopped, "")
+	log.Println("[kakao] Webhook server stopped")
+}
 
+// setStateLocked moves the server to state; the change is published as a
+// "kakao:status" event when s.mu is released through unlock
+func (s *Server) setStateLocked(state State, reason string) {
+	s.state = state
+	s.stateErr = reason
+	s.transitions = append(s.transitions, s.statusLocked())
+}
+
+// unlock releases s.mu and then publishes the state changes made while it
+// was held, so event handlers may call back into the server
+func (s *Server) unlock() {
+	pending := s.transitions
+	s.transitions = nil
+	s.mu.Unlock()
+
+	for _, status := range pending {
+		s.emit("kakao:status", status)
+	}
+}
+
+// shutdown gracefully stops srv, giving in-flight requests 5 seconds
+func shutdown(srv *http.Server) {
+	if srv == nil {
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := s.server.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("[kakao] Shutdown error: %v", err)
 	}
-
-	s.running = false
-	log.Println("[kakao] Webhook server stopped")
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -267,6 +592,21 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	config, ok := s.GetConfig().botFor(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.bots.record(config.bot, time.Now())
+
+	// The simulator runs in this process, so its requests skip the checks
+	// meant for Open Builder's
+	config.simulated = s.fromSimulator(r)
+	if reason := verifyTransport(r, config); reason != "" && !config.simulated {
+		s.reject(w, r, config, nil, reason)
+		return
+	}
+
 	var req KakaoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("[kakao] Failed to decode request: %v", err)
@@ -274,6 +614,11 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if reason := verifyBot(&req, config); reason != "" {
+		s.reject(w, r, config, &req, reason)
+		return
+	}
+
 	if req.UserRequest == nil {
 		sendJSON(w, http.StatusBadRequest, NewSimpleTextResponse("잘못된 요청입니다."))
 		return
@@ -297,90 +642,187 @@ func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	log.Printf("[kakao] Message from %s: %s", senderID, message)
+	log.Printf("[kakao] Message from %s to %s: %s", senderID, config.bot, message)
+
+	// Simulator requests don't count against the bot's rate limits
+	if !config.simulated {
+		if reason := s.bots.limiter(config.bot).check(senderID, utf8.RuneCountInString(message), config.RateLimit, time.Now(), s.known(config, senderID)); reason != limitNone {
+			log.Printf("[kakao] Limited %s: %s", senderID, reason)
+			response := reason.message(config.RateLimit)
+			s.logConversation(config, Conversation{
+				Bot:       config.bot,
+				SenderID:  senderID,
+				Utterance: message,
+				Response:  response,
+				Error:     "limited: " + string(reason),
+			})
+			sendJSON(w, http.StatusOK, NewSimpleTextResponse(response))
+			return
+		}
+	}
 
-	// Handle callback URL (async processing)
-	if req.UserRequest.CallbackURL != "" {
-		go s.processAsync(req.UserRequest.CallbackURL, senderID, message)
-		sendJSON(w, http.StatusOK, NewCallbackInitialResponse())
+	if denied := s.checkAccess(config, senderID, message); denied != "" {
+		s.logReply(config, senderID, message, denied, time.Now())
+		sendJSON(w, http.StatusOK, NewSimpleTextResponse(denied))
 		return
 	}
 
-	// Synchronous processing
-	response := s.processMessage(senderID, message)
-	sendJSON(w, http.StatusOK, NewSimpleTextResponse(response))
-}
+	if strings.HasPrefix(message, "/") {
+		start := time.Now()
+		response := s.runCommand(config, senderID, message)
+		s.logConversation(config, Conversation{
+			Bot:       config.bot,
+			SenderID:  senderID,
+			Utterance: message,
+			Response:  response,
+			LatencyMs: time.Since(start).Milliseconds(),
+		})
+		sendJSON(w, http.StatusOK, NewSimpleTextResponse(response))
+		return
+	}
 
-func (s *Server) processMessage(senderID, message string) string {
-	config := s.GetConfig()
+	if s.inbox.has(config.userKey(senderID)) {
+		s.waitForAdmin(w, config, req.UserRequest.CallbackURL, senderID, message)
+		return
+	}
 
-	// Access control
-	if config.DMPolicy == "disabled" {
-		return "이 봇은 현재 비활성화되어 있습니다."
+	var urls []string
+	if config.Attachments {
+		urls = attachmentURLs(message, req.Action)
 	}
 
-	if config.DMPolicy == "allowlist" && len(config.AllowFrom) > 0 {
-		allowed := false
-		for _, id := range config.AllowFrom {
-			if id == "*" || strings.EqualFold(id, senderID) {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			return "접근이 허용되지 않았습니다."
+	route := findRoute(config, req.UserRequest.Block)
+	if route != nil {
+		log.Printf("[kakao] Routing block %s to %s", route.key(), route.Type)
+	}
+	run := func(ctx context.Context) answer {
+		text := s.withAttachments(ctx, config, senderID, message, urls)
+		if route != nil {
+			return s.runRoute(ctx, config, *route, senderID, text, req.Action)
 		}
+		return s.processMessage(ctx, config, senderID, text)
 	}
 
-	// Call Ollama
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+	s.reply(w, config, req.UserRequest.CallbackURL, senderID, message, run)
+}
 
-	var systemPrompt *string
-	if config.SystemPrompt != "" {
-		systemPrompt = &config.SystemPrompt
+// checkAccess applies the DM policy, returning the reply for a sender who
+// may not use the bot or "" if they may
+func (s *Server) checkAccess(config *Config, senderID, message string) string {
+	if s.known(config, senderID) {
+		return ""
 	}
-
-	response, err := s.ollama.Chat(ctx, config.Model, message, systemPrompt)
-	if err != nil {
-		log.Printf("[kakao] Ollama error: %v", err)
-		return fmt.Sprintf("AI 응답 생성 중 오류가 발생했습니다: %v", err)
+	switch config.DMPolicy {
+	case "disabled":
+		return "이 봇은 현재 비활성화되어 있습니다."
+	case "pairing":
+		return s.checkPairing(config, senderID, message)
+	default:
+		return "접근이 허용되지 않았습니다."
 	}
+}
 
-	// Truncate if too long (Kakao limit: 1000 chars)
-	if len(response) > 900 {
-		response = response[:900] + "...\n\n(응답이 너무 길어 일부만 표시)"
+// known reports whether the DM policy lets senderID talk to the bot as is
+func (s *Server) known(config *Config, senderID string) bool {
+	switch config.DMPolicy {
+	case "disabled":
+		return false
+	case "allowlist":
+		return len(config.AllowFrom) == 0 || s.allowed(config, senderID)
+	case "pairing":
+		return s.allowed(config, senderID) || s.pairing.isPaired(config.bot, senderID)
 	}
+	return true
+}
 
-	return response
+// allowed reports whether senderID is in the allowlist
+func (s *Server) allowed(config *Config, senderID string) bool {
+	for _, id := range config.AllowFrom {
+		if id == "*" || strings.EqualFold(id, senderID) {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *Server) processAsync(callbackURL, senderID, message string) {
-	response := s.processMessage(senderID, message)
+// answer is the outcome of handling one message: the reply for the user,
+// the model that produced it and the failure behind an error reply
+type answer struct {
+	text  string
+	model string
+	err   error
+}
 
-	payload := NewSimpleTextResponse(response)
-	body, _ := json.Marshal(payload)
+func (s *Server) processMessage(ctx context.Context, config *Config, senderID, message string) answer {
+	return s.ask(ctx, config, senderID, message, "")
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ask runs message through the agent in the sender's session, using the
+// given profile instead of the sender's choice if set
+func (s *Server) ask(ctx context.Context, config *Config, senderID, message, profile string) answer {
+	// Run through the agent in the user's session
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	defer s.track(config.userKey(senderID), cancel)()
+	ctx = ollama.WithSource(ctx, ollama.SourceKakao)
 
-	req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("[kakao] Failed to create callback request: %v", err)
-		return
+	settings, _ := s.resolve(config, senderID)
+	if p, ok := config.Profiles[profile]; ok {
+		settings = p.over(settings)
+	}
+	allowedTools := settings.AllowedTools
+	if allowedTools == nil {
+		allowedTools = []string{}
+	}
+
+	systemPrompt := settings.SystemPrompt
+	if config.RichReplies {
+		systemPrompt += richReplyPrompt
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	response, err := s.agent.ProcessMessageWithOptions(ctx, sessionID(config.userKey(senderID)), message, agent.RunOptions{
+		Model:        settings.Model,
+		SystemPrompt: systemPrompt,
+		AllowedTools: allowedTools,
+	})
+	if errors.Is(err, context.Canceled) {
+		return answer{text: "답변 생성을 중단했습니다.", model: settings.Model, err: err}
+	}
+	if errors.Is(err, ollama.ErrQueueFull) {
+		return answer{text: "요청이 많아 잠시 후 다시 시도해 주세요.", model: settings.Model, err: err}
+	}
 	if err != nil {
-		log.Printf("[kakao] Callback failed: %v", err)
-		return
+		log.Printf("[kakao] Ollama error: %v", err)
+		return answer{text: fmt.Sprintf("AI 응답 생성 중 오류가 발생했습니다: %v", err), model: settings.Model, err: err}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[kakao] Callback returned status %d", resp.StatusCode)
+	return answer{text: response, model: settings.Model}
+}
+
+// janitor drops idle Kakao conversations and stale rate limit state until
+// ctx is cancelled
+func (s *Server) janitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.bots.prune(now)
+			s.late.prune(now)
+			s.pages.prune(now)
+			s.conversations.prune(s.GetConfig().LogRetentionDays, now)
+
+			idle := s.GetConfig().SessionIdleMinutes
+			if idle <= 0 {
+				continue
+			}
+			if expired := s.agent.ExpireSessions(sessionPrefix, time.Duration(idle)*time.Minute); len(expired) > 0 {
+				log.Printf("[kakao] Expired %d idle sessions", len(expired))
+			}
+		}
 	}
 }
 
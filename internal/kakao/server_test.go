@@ -0,0 +1,124 @@
+package kakao
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"DubaiCrab/internal/agent"
+	"DubaiCrab/internal/ollama"
+	"DubaiCrab/internal/ollama/ollamatest"
+	"DubaiCrab/internal/tools"
+)
+
+func newTestServer(t *testing.T) (*Server, *ollamatest.Server) {
+	t.Helper()
+	srv := ollamatest.NewServer()
+	t.Cleanup(srv.Close)
+
+	m := ollama.NewManager()
+	m.SetBaseURL(srv.URL)
+
+	return NewServer(m, agent.NewAgent(m, tools.NewRegistry())), srv
+}
+
+// postWebhook sends req to the webhook at path with the given extra headers
+// and decodes the JSON response, if there is one
+func postWebhook(t *testing.T, s *Server, path string, req KakaoRequest, header http.Header) (int, KakaoResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	s.handleWebhook(rec, r)
+
+	var resp KakaoResponse
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+		}
+	}
+	return rec.Code, resp
+}
+
+func userRequest(userID, utterance string) KakaoRequest {
+	return KakaoRequest{
+		UserRequest: &KakaoUserRequest{
+			Utterance: utterance,
+			User:      &KakaoUser{ID: userID},
+		},
+	}
+}
+
+func TestWebhookSyncReply(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("안녕하세요!")
+
+	code, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(resp.Template.Outputs) != 1 || resp.Template.Outputs[0].SimpleText.Text != "안녕하세요!" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestWebhookEmptyUtterance(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	code, _ := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "  "), nil)
+	if code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", code)
+	}
+}
+
+func TestWebhookAllowlist(t *testing.T) {
+	s, srv := newTestServer(t)
+	cfg := DefaultConfig()
+	cfg.DMPolicy = "allowlist"
+	cfg.AllowFrom = []string{"u1"}
+	s.UpdateConfig(cfg)
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u2", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "접근이 허용되지 않았습니다." {
+		t.Errorf("blocked user got %q", got)
+	}
+	if len(srv.ChatRequests()) != 0 {
+		t.Error("blocked user reached the LLM")
+	}
+
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; !strings.Contains(got, "안녕") {
+		t.Errorf("allowed user got %q", got)
+	}
+}
+
+func TestWebhookSessionPerUser(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "내 이름은 철수야"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u2", "안녕"), nil)
+	postWebhook(t, s, "/kakao/webhook", userRequest("u1", "내 이름이 뭐야?"), nil)
+
+	reqs := srv.ChatRequests()
+	var turns []string
+	for _, m := range reqs[len(reqs)-1].Messages[1:] {
+		turns = append(turns, m.Content)
+	}
+	prompt := strings.Join(turns, "\n")
+	if !strings.Contains(prompt, "철수") {
+		t.Errorf("u1 lost its history: %q", prompt)
+	}
+	if strings.Contains(prompt, "안녕") {
+		t.Errorf("u2's message leaked into u1's session: %q", prompt)
+	}
+	if reqs[0].Messages[0].Role != "system" || !strings.HasPrefix(reqs[0].Messages[0].Content, DefaultConfig().SystemPrompt) {
+		t.Errorf("Kakao system prompt not used: %+v", reqs[0].Messages[0])
+	}
+}
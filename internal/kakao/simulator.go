@@ -0,0 +1,336 @@
+package kakao
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const simulatorUserID = "simulator"
+
+// simulatorHeader carries the token that marks a request as sent by the
+// simulator. The token is new every run and never leaves the process.
+const simulatorHeader = "X-Simulator-Token"
+
+// simulatorClient has no timeout of its own; the skill deadline and the
+// callback window bound a simulated exchange
+var simulatorClient = &http.Client{}
+
+func newSimulatorToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// fromSimulator reports whether r was sent by Simulate
+func (s *Server) fromSimulator(r *http.Request) bool {
+	token := r.Header.Get(simulatorHeader)
+	return s.simulatorToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.simulatorToken)) == 1
+}
+
+// SimulatorRequest describes a skill request to send to the local webhook
+// as if it came from Open Builder
+type SimulatorRequest struct {
+	Bot       string            `json:"bot"` // bot name; empty for the main bot
+	UserID    string            `json:"userId"`
+	Utterance string            `json:"utterance"`
+	BlockID   string            `json:"blockId"`
+	BlockName string            `json:"blockName"`
+	Params    map[string]string `json:"params"`
+	Callback  bool              `json:"callback"` // send a callbackUrl served by the simulator
+}
+
+// SimulatorResult is the raw exchange with the webhook and a text preview
+// of what the user would see
+type SimulatorResult struct {
+	Request         json.RawMessage `json:"request"`
+	Status          int             `json:"status"`
+	Response        json.RawMessage `json:"response"`
+	Preview         string          `json:"preview"`
+	LatencyMs       int64           `json:"latencyMs"`
+	Callback        json.RawMessage `json:"callback,omitempty"`
+	CallbackPreview string          `json:"callbackPreview,omitempty"`
+	CallbackMs      int64           `json:"callbackMs,omitempty"` // since the request was sent
+}
+
+// Simulate posts a skill request to the running webhook server, waiting up
+// to the callback window for a callback if the reply switched to one
+func (s *Server) Simulate(sim SimulatorRequest) (*SimulatorResult, error) {
+	status := s.GetStatus()
+	if status.State != StateRunning {
+		return nil, fmt.Errorf("webhook server is not running")
+	}
+
+	config := s.GetConfig()
+	bot := config
+	if sim.Bot != "" && sim.Bot != mainBot {
+		found := false
+		for _, b := range config.Bots {
+			if b.Name == sim.Bot {
+				bot, found = config.forBot(b), true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown bot: %s", sim.Bot)
+		}
+	}
+
+	var callbacks chan []byte
+	callbackURL := ""
+	if sim.Callback {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to start callback receiver: %w", err)
+		}
+		callbacks = make(chan []byte, 1)
+		receiver := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			select {
+			case callbacks <- body:
+			default:
+			}
+			sendJSON(w, http.StatusOK, callbackResult{TaskID: "simulator", Status: "SUCCESS"})
+		})}
+		go receiver.Serve(ln)
+		defer shutdown(receiver)
+		callbackURL = "http://" + ln.Addr().String() + "/callback"
+	}
+
+	body, err := json.MarshalIndent(simulatorPayload(sim, bot, callbackURL), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", status.Port, bot.WebhookPath)
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(simulatorHeader, s.simulatorToken)
+	if config.WebhookSecret != "" {
+		httpReq.Header.Set(SecretHeader, config.WebhookSecret)
+	}
+
+	sent := time.Now()
+	resp, err := simulatorClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook response: %w", err)
+	}
+
+	result := &SimulatorResult{
+		Request:   body,
+		Status:    resp.StatusCode,
+		Response:  rawJSON(respBody),
+		LatencyMs: time.Since(sent).Milliseconds(),
+	}
+
+	var reply KakaoResponse
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		result.Preview = strings.TrimSpace(string(respBody))
+		return result, nil
+	}
+	result.Preview = PreviewResponse(&reply)
+
+	if callbacks == nil || reply.UseCallback == nil || !*reply.UseCallback {
+		return result, nil
+	}
+	select {
+	case data := <-callbacks:
+		result.Callback = rawJSON(data)
+		result.CallbackMs = time.Since(sent).Milliseconds()
+		var cb KakaoResponse
+		if err := json.Unmarshal(data, &cb); err == nil {
+			result.CallbackPreview = PreviewResponse(&cb)
+		}
+	case <-time.After(callbackWindow):
+		result.CallbackPreview = "(콜백이 도착하지 않았습니다)"
+	}
+	return result, nil
+}
+
+// simulatorPayload builds a skill request shaped like Open Builder's
+func simulatorPayload(sim SimulatorRequest, bot *Config, callbackURL string) *KakaoRequest {
+	userID := sim.UserID
+	if userID == "" {
+		userID = simulatorUserID
+	}
+	botID := bot.BotID
+	if botID == "" {
+		botID = "simulator-bot"
+	}
+
+	action := &KakaoAction{
+		ID:           "simulator-action",
+		Name:         "스킬",
+		Params:       map[string]string{},
+		DetailParams: map[string]KakaoDetailParam{},
+		ClientExtra:  map[string]interface{}{},
+	}
+	for name, value := range sim.Params {
+		action.Params[name] = value
+		action.DetailParams[name] = KakaoDetailParam{Origin: value, Value: value, GroupName: ""}
+	}
+
+	req := &KakaoRequest{
+		Bot: &KakaoBot{ID: botID, Name: bot.bot},
+		UserRequest: &KakaoUserRequest{
+			Utterance: sim.Utterance,
+			User: &KakaoUser{
+				ID:   userID,
+				Type: "botUserKey",
+				Properties: map[string]interface{}{
+					"botUserKey": userID,
+					"isFriend":   true,
+				},
+			},
+			Params:      map[string]string{"surface": "Kakaotalk.plusfriend"},
+			CallbackURL: callbackURL,
+			Lang:        "ko",
+			Timezone:    "Asia/Seoul",
+		},
+		Action: action,
+	}
+	if sim.BlockID != "" || sim.BlockName != "" {
+		req.UserRequest.Block = &KakaoBlock{ID: sim.BlockID, Name: sim.BlockName}
+	}
+	if bot.bot == "" {
+		req.Bot.Name = mainBot
+	}
+	return req
+}
+
+// rawJSON returns data as raw JSON, quoting it if it is not valid JSON
+func rawJSON(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return data
+	}
+	quoted, _ := json.Marshal(string(data))
+	return quoted
+}
+
+// PreviewResponse renders a skill response as plain text, roughly as the
+// chat would show it
+func PreviewResponse(resp *KakaoResponse) string {
+	var parts []string
+	if resp.UseCallback != nil && *resp.UseCallback {
+		text := "(콜백으로 응답 예정)"
+		if resp.Data != nil && resp.Data.Text != "" {
+			text += " " + resp.Data.Text
+		}
+		parts = append(parts, text)
+	}
+
+	for _, o := range resp.Template.Outputs {
+		parts = append(parts, previewOutput(o))
+	}
+
+	if len(resp.Template.QuickReplies) > 0 {
+		labels := make([]string, len(resp.Template.QuickReplies))
+		for i, q := range resp.Template.QuickReplies {
+			labels[i] = q.Label
+		}
+		parts = append(parts, "[빠른 답장] "+strings.Join(labels, " | "))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func previewOutput(o KakaoOutput) string {
+	switch {
+	case o.SimpleText != nil:
+		return o.SimpleText.Text
+	case o.SimpleImage != nil:
+		return fmt.Sprintf("[이미지] %s (%s)", o.SimpleImage.AltText, o.SimpleImage.ImageURL)
+	case o.BasicCard != nil:
+		return previewCard("카드", o.BasicCard)
+	case o.TextCard != nil:
+		return previewCard("텍스트 카드", o.TextCard)
+	case o.ListCard != nil:
+		return previewCard("목록", o.ListCard)
+	case o.ItemCard != nil:
+		return previewCard("아이템 카드", o.ItemCard)
+	case o.Carousel != nil:
+		lines := []string{fmt.Sprintf("[캐러셀 %d개]", len(o.Carousel.Items))}
+		if h := o.Carousel.Header; h != nil {
+			lines = append(lines, h.Title)
+		}
+		for _, item := range o.Carousel.Items {
+			lines = append(lines, previewCard("카드", item))
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+// previewCard renders any of the card types
+func previewCard(kind string, card interface{}) string {
+	var lines []string
+	var buttons []Button
+	add := func(s string) {
+		if s != "" {
+			lines = append(lines, s)
+		}
+	}
+
+	switch c := card.(type) {
+	case *BasicCard:
+		add(fmt.Sprintf("[%s] %s", kind, c.Title))
+		add(c.Description)
+		if c.Thumbnail != nil {
+			add("(이미지 " + c.Thumbnail.ImageURL + ")")
+		}
+		buttons = c.Buttons
+	case *TextCard:
+		add(fmt.Sprintf("[%s] %s", kind, c.Title))
+		add(c.Description)
+		buttons = c.Buttons
+	case *ListCard:
+		add(fmt.Sprintf("[%s] %s", kind, c.Header.Title))
+		for _, item := range c.Items {
+			if item.Description != "" {
+				add(fmt.Sprintf("- %s: %s", item.Title, item.Description))
+			} else {
+				add("- " + item.Title)
+			}
+		}
+		buttons = c.Buttons
+	case *ItemCard:
+		title := c.Title
+		if c.Head != nil {
+			title = c.Head.Title
+		}
+		add(fmt.Sprintf("[%s] %s", kind, title))
+		if c.ImageTitle != nil {
+			add(c.ImageTitle.Title)
+		}
+		for _, row := range c.ItemList {
+			add(fmt.Sprintf("%s: %s", row.Title, row.Description))
+		}
+		if c.ItemListSummary != nil {
+			add(fmt.Sprintf("%s: %s", c.ItemListSummary.Title, c.ItemListSummary.Description))
+		}
+		add(c.Description)
+		buttons = c.Buttons
+	}
+
+	for _, b := range buttons {
+		add("[버튼] " + b.Label)
+	}
+	return strings.Join(lines, "\n")
+}
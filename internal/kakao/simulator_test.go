@@ -0,0 +1,131 @@
+package kakao
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulatorSyncReply(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("시뮬레이터 답변")
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	cfg.WebhookSecret = "s3cret"
+	cfg.Routes = []Route{{BlockID: "b1", Type: RoutePrompt, Prompt: "날짜: {{.Params.date}}"}}
+	s.UpdateConfig(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	result, err := s.Simulate(SimulatorRequest{Utterance: "내일 일정", BlockID: "b1", Params: map[string]string{"date": "2026-10-20"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != 200 || !strings.Contains(result.Preview, "시뮬레이터 답변") {
+		t.Errorf("result = %d %q (%s)", result.Status, result.Preview, result.Response)
+	}
+
+	var sent KakaoRequest
+	if err := json.Unmarshal(result.Request, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.UserRequest.User.ID != simulatorUserID || sent.Action.DetailParams["date"].Value != "2026-10-20" {
+		t.Errorf("request = %s", result.Request)
+	}
+
+	msgs := srv.ChatRequests()[0].Messages
+	if last := msgs[len(msgs)-1].Content; !strings.Contains(last, "날짜: 2026-10-20") {
+		t.Errorf("routed prompt = %q", last)
+	}
+}
+
+func TestSimulatorCallback(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("늦은 답변")
+	srv.SetLatency("/api/chat", 150*time.Millisecond)
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	cfg.ReplyTimeoutMs = 50
+	s.UpdateConfig(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	result, err := s.Simulate(SimulatorRequest{UserID: "u1", Utterance: "질문", Callback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result.Preview, "(콜백으로 응답 예정)") {
+		t.Errorf("preview = %q", result.Preview)
+	}
+	if result.CallbackPreview != "늦은 답변" || len(result.Callback) == 0 {
+		t.Errorf("callback = %q (%s)", result.CallbackPreview, result.Callback)
+	}
+}
+
+func TestSimulatorKeptApartFromRealTraffic(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("네")
+	s.SetDataDir(t.TempDir())
+	cfg := DefaultConfig()
+	cfg.Port = freePort(t)
+	cfg.AllowedIPs = []string{"10.0.0.1"}
+	cfg.RateLimit = RateLimit{Enabled: true, PerUserPerMinute: 1, PerUserBurst: 1}
+	s.UpdateConfig(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Simulate(SimulatorRequest{UserID: "u1", Utterance: "안녕"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != 200 || result.Preview != "네" {
+			t.Errorf("simulation %d = %d %q", i, result.Status, result.Preview)
+		}
+	}
+
+	if history := s.agent.GetSessionHistory(sessionID(userKey(mainBot, "u1"))); len(history) != 0 {
+		t.Errorf("simulator wrote to u1's session: %+v", history)
+	}
+	page, _ := s.Conversations(ConversationQuery{})
+	if page.Total != 2 || !page.Entries[0].Simulated {
+		t.Errorf("log = %+v", page.Entries)
+	}
+}
+
+func TestSimulatorNotRunning(t *testing.T) {
+	s, _ := newTestServer(t)
+	if _, err := s.Simulate(SimulatorRequest{Utterance: "안녕"}); err == nil {
+		t.Error("expected error while stopped")
+	}
+}
+
+func TestPreviewResponse(t *testing.T) {
+	resp := &KakaoResponse{
+		Version: "2.0",
+		Template: KakaoTemplate{
+			Outputs: []KakaoOutput{
+				TextOutput("영수증 내역입니다"),
+				{ItemCard: &ItemCard{
+					Head:            &ItemHead{Title: "영수증"},
+					ItemList:        []ItemListEntry{{Title: "커피", Description: "4,500원"}},
+					ItemListSummary: &ItemListEntry{Title: "합계", Description: "4,500원"},
+					Buttons:         []Button{{Label: "저장", Action: "message"}},
+				}},
+			},
+			QuickReplies: []QuickReply{{Label: "더보기", Action: "message"}},
+		},
+	}
+
+	want := "영수증 내역입니다\n\n[아이템 카드] 영수증\n커피: 4,500원\n합계: 4,500원\n[버튼] 저장\n\n[빠른 답장] 더보기"
+	if got := PreviewResponse(resp); got != want {
+		t.Errorf("preview =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package kakao
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTextRunes is the character limit of a simpleText output
+const maxTextRunes = 1000
+
+// moreLabel is the quick reply that fetches the next page of a long answer
+const moreLabel = "더보기"
+
+// pagesTTL is how long the rest of a long answer stays available
+const pagesTTL = 30 * time.Minute
+
+// sentenceEnds mark sentence boundaries for splitting
+var sentenceEnds = []string{". ", "? ", "! ", ".\n", "。"}
+
+// splitText splits text into chunks of at most limit characters, cutting at
+// paragraph, line, sentence or word boundaries where possible
+func splitText(text string, limit int) []string {
+	var chunks []string
+	for {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return chunks
+		}
+
+		runes := []rune(text)
+		if len(runes) <= limit {
+			return append(chunks, text)
+		}
+
+		cut := splitPoint(runes[:limit])
+		chunks = append(chunks, strings.TrimSpace(string(runes[:cut])))
+		text = string(runes[cut:])
+	}
+}
+
+// splitPoint returns the rune offset to cut window at. Boundaries in the
+// first half of the window are ignored so chunks don't get too short.
+func splitPoint(window []rune) int {
+	min := len(window) / 2
+	for _, seps := range [][]string{{"\n\n"}, {"\n"}, sentenceEnds, {" "}} {
+		best := -1
+		for _, sep := range seps {
+			if i := lastIndexRunes(window, []rune(sep)); i >= min && i+len([]rune(sep)) > best {
+				best = i + len([]rune(sep))
+			}
+		}
+		if best > 0 {
+			return best
+		}
+	}
+	return len(window)
+}
+
+func lastIndexRunes(s, sep []rune) int {
+	for i := len(s) - len(sep); i >= 0; i-- {
+		match := true
+		for j := range sep {
+			if s[i+j] != sep[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// pendingPages is the unsent rest of a long answer
+type pendingPages struct {
+	chunks  []string
+	expires time.Time
+}
+
+// pageStore keeps the rest of long answers per user for "더보기"
+type pageStore struct {
+	mu    sync.Mutex
+	pages map[string]*pendingPages
+}
+
+// set replaces the pending pages of a user; no chunks clears them
+func (p *pageStore) set(key string, chunks []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(chunks) == 0 {
+		delete(p.pages, key)
+		return
+	}
+	if p.pages == nil {
+		p.pages = make(map[string]*pendingPages)
+	}
+	p.pages[key] = &pendingPages{chunks: chunks, expires: time.Now().Add(pagesTTL)}
+}
+
+// next removes and returns up to n pending chunks of a user, and whether
+// more remain
+func (p *pageStore) next(key string, n int) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.pages[key]
+	if !ok || time.Now().After(pending.expires) {
+		delete(p.pages, key)
+		return nil, false
+	}
+
+	if n > len(pending.chunks) {
+		n = len(pending.chunks)
+	}
+	chunks := pending.chunks[:n]
+	pending.chunks = pending.chunks[n:]
+	if len(pending.chunks) == 0 {
+		delete(p.pages, key)
+		return chunks, false
+	}
+	return chunks, true
+}
+
+// prune drops pages that were never asked for before they expired
+func (p *pageStore) prune(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, pending := range p.pages {
+		if now.After(pending.expires) {
+			delete(p.pages, key)
+		}
+	}
+}
+
+// moreQuickReply fetches the next page of a long answer
+func moreQuickReply() QuickReply {
+	return QuickReply{Label: moreLabel, Action: "message", MessageText: moreLabel}
+}
+
+// nextPage answers "더보기" with the next pages of the user's last answer
+func (s *Server) nextPage(key string) (*KakaoResponse, bool) {
+	chunks, more := s.pages.next(key, maxOutputs)
+	if len(chunks) == 0 {
+		return nil, false
+	}
+
+	var template KakaoTemplate
+	for _, chunk := range chunks {
+		template.Outputs = append(template.Outputs, TextOutput(chunk))
+	}
+	if more {
+		template.QuickReplies = []QuickReply{moreQuickReply()}
+	}
+	return NewTemplateResponse(template), true
+}
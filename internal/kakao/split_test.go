@@ -0,0 +1,85 @@
+package kakao
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplitTextRuneSafe(t *testing.T) {
+	text := strings.Repeat("가나다라마바사아자차카타파하", 200) // no boundaries at all
+
+	chunks := splitText(text, maxTextRunes)
+	if len(chunks) != 3 {
+		t.Fatalf("%d chunks, want 3", len(chunks))
+	}
+	if got := strings.Join(chunks, ""); got != text {
+		t.Error("chunks do not add up to the original text")
+	}
+	for i, c := range chunks {
+		if !utf8.ValidString(c) {
+			t.Errorf("chunk %d is not valid UTF-8", i)
+		}
+		if n := utf8.RuneCountInString(c); n > maxTextRunes {
+			t.Errorf("chunk %d has %d characters", i, n)
+		}
+	}
+}
+
+func TestSplitTextBoundaries(t *testing.T) {
+	sentence := "이 문장은 테스트를 위한 문장입니다. "
+	para := strings.Repeat(sentence, 10)
+	text := para + "\n\n" + para
+
+	chunks := splitText(text, utf8.RuneCountInString(para)+10)
+	if len(chunks) != 2 || chunks[0] != strings.TrimSpace(para) {
+		t.Errorf("expected a paragraph split, got %q", chunks)
+	}
+
+	chunks = splitText(para, utf8.RuneCountInString(sentence)*3+5)
+	for i, c := range chunks {
+		if !strings.HasSuffix(c, "입니다.") {
+			t.Errorf("chunk %d does not end at a sentence: %q", i, c)
+		}
+	}
+}
+
+func TestWebhookLongReplyPages(t *testing.T) {
+	s, srv := newTestServer(t)
+	paragraph := strings.Repeat("가", 900)
+	srv.SetChatReply(strings.TrimSpace(strings.Repeat(paragraph+"\n\n", 5)))
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "길게 설명해줘"), nil)
+	if n := len(resp.Template.Outputs); n != maxOutputs {
+		t.Fatalf("%d outputs, want %d", n, maxOutputs)
+	}
+	if len(resp.Template.QuickReplies) != 1 || resp.Template.QuickReplies[0].MessageText != moreLabel {
+		t.Fatalf("missing 더보기 quick reply: %+v", resp.Template.QuickReplies)
+	}
+
+	_, resp = postWebhook(t, s, "/kakao/webhook", userRequest("u1", moreLabel), nil)
+	if n := len(resp.Template.Outputs); n != 2 {
+		t.Errorf("second page has %d outputs, want 2", n)
+	}
+	if len(resp.Template.QuickReplies) != 0 {
+		t.Errorf("last page offers more: %+v", resp.Template.QuickReplies)
+	}
+	if len(srv.ChatRequests()) != 1 {
+		t.Errorf("더보기 reached the LLM")
+	}
+}
+
+func TestPageStorePrune(t *testing.T) {
+	var p pageStore
+	p.set("u1", []string{"a", "b"})
+
+	p.prune(time.Now())
+	if len(p.pages) != 1 {
+		t.Fatalf("fresh pages pruned: %d left", len(p.pages))
+	}
+	p.prune(time.Now().Add(pagesTTL + time.Second))
+	if len(p.pages) != 0 {
+		t.Errorf("expired pages kept: %d left", len(p.pages))
+	}
+}
@@ -0,0 +1,135 @@
+package kakao
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Description limits of the cards text can be folded into
+const (
+	maxTextCardRunes  = 400
+	maxBasicCardRunes = 230
+)
+
+// replyFence opens the block through which the agent returns rich outputs
+const replyFence = "```kakao"
+
+// richReplyPrompt is appended to the system prompt to describe the
+// structured output contract to the model
+const richReplyPrompt = `
+
+## 카카오톡 응답 형식
+기본적으로 일반 텍스트로 답하세요. 버튼, 카드, 목록, 빠른 답장이 도움이 될 때만 답변 끝에 카카오 스킬 응답의 template 형식을 담은 kakao 코드 블록을 하나 덧붙이세요. 예:
+` + replyFence + `
+{"outputs":[{"listCard":{"header":{"title":"검색 결과"},"items":[{"title":"제목","description":"설명"}]}}],"quickReplies":[{"label":"더 알려줘","action":"message","messageText":"더 알려줘"}]}
+` + "```" + `
+- outputs: simpleImage, basicCard, textCard, listCard, itemCard, carousel 중 사용 (최대 3개)
+- quickReplies: 후속 질문 제안 (최대 10개, action은 "message")
+- listCard: 항목 최대 5개, 버튼 최대 2개 / 그 밖의 카드: 버튼 최대 3개
+- carousel: 카드 최대 10개 (listCard는 5개, 카드당 항목 4개)
+- 버튼 action: "webLink"(webLinkUrl), "message"(messageText), "phone"(phoneNumber)
+`
+
+// ParseReply splits an agent reply into its plain text and the template in
+// an optional kakao block. If the block is malformed the text is still
+// returned, without the block, along with the error.
+func ParseReply(reply string) (string, *KakaoTemplate, error) {
+	start := strings.Index(reply, replyFence)
+	if start == -1 {
+		return strings.TrimSpace(reply), nil, nil
+	}
+
+	body := reply[start+len(replyFence):]
+	end := strings.Index(body, "```")
+	rest := ""
+	if end == -1 {
+		end = len(body)
+	} else {
+		rest = body[end+3:]
+	}
+
+	text := strings.TrimSpace(strings.TrimSpace(reply[:start]) + "\n\n" + strings.TrimSpace(rest))
+
+	var template KakaoTemplate
+	if err := json.Unmarshal([]byte(body[:end]), &template); err != nil {
+		return text, nil, fmt.Errorf("invalid kakao block: %w", err)
+	}
+	return text, &template, nil
+}
+
+// renderReply turns an agent reply into a skill response for a user: the
+// plain text becomes simpleText outputs followed by any rich outputs from the
+// reply. Text that does not fit is kept for the "더보기" quick reply.
+func (s *Server) renderReply(key, reply string) *KakaoResponse {
+	text, rich, err := ParseReply(reply)
+	if err != nil {
+		log.Printf("[kakao] %v", err)
+	}
+	if rich == nil {
+		rich = &KakaoTemplate{}
+	}
+	rich.normalize()
+
+	chunks := splitText(text, maxTextRunes)
+	if len(chunks) > 0 && len(rich.Outputs) >= maxOutputs {
+		// No slot is left for the text: fold it into the first card if it
+		// fits, otherwise give up the last rich output for it
+		if rich.Outputs[0].foldText(text) {
+			chunks = nil
+		} else {
+			log.Printf("[kakao] Dropping a rich output to make room for the reply text")
+			rich.Outputs = rich.Outputs[:maxOutputs-1]
+		}
+	}
+	slots := maxOutputs - len(rich.Outputs)
+
+	var template KakaoTemplate
+	var rest []string
+	if len(chunks) > slots {
+		chunks, rest = chunks[:slots], chunks[slots:]
+	}
+	for _, chunk := range chunks {
+		template.Outputs = append(template.Outputs, TextOutput(chunk))
+	}
+	template.Outputs = append(template.Outputs, rich.Outputs...)
+	template.QuickReplies = rich.QuickReplies
+
+	s.pages.set(key, rest)
+	if len(rest) > 0 {
+		template.QuickReplies = append([]QuickReply{moreQuickReply()}, template.QuickReplies...)
+	}
+
+	if len(template.Outputs) == 0 {
+		template.Outputs = append(template.Outputs, TextOutput("응답이 비어 있습니다."))
+	}
+
+	return NewTemplateResponse(template)
+}
+
+// foldText prepends text to the description of a text or basic card,
+// reporting whether it fit
+func (o *KakaoOutput) foldText(text string) bool {
+	var desc *string
+	limit := 0
+	switch {
+	case o.TextCard != nil:
+		desc, limit = &o.TextCard.Description, maxTextCardRunes
+	case o.BasicCard != nil:
+		desc, limit = &o.BasicCard.Description, maxBasicCardRunes
+	default:
+		return false
+	}
+
+	folded := text
+	if *desc != "" {
+		folded += "\n\n" + *desc
+	}
+	if utf8.RuneCountInString(folded) > limit {
+		return false
+	}
+	*desc = folded
+	return true
+}
@@ -0,0 +1,134 @@
+package kakao
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseReplyPlainText(t *testing.T) {
+	text, tpl, err := ParseReply("  그냥 답변입니다.  ")
+	if err != nil || tpl != nil || text != "그냥 답변입니다." {
+		t.Errorf("got %q, %v, %v", text, tpl, err)
+	}
+}
+
+func TestParseReplyRichBlock(t *testing.T) {
+	reply := "검색 결과입니다.\n```kakao\n" +
+		`{"outputs":[{"carousel":{"type":"basicCard","items":[{"title":"A"},{"title":"B"}]}}],` +
+		`"quickReplies":[{"label":"더 보기","action":"message","messageText":"더 보기"}]}` +
+		"\n```\n참고하세요."
+
+	text, tpl, err := ParseReply(reply)
+	if err != nil {
+		t.Fatalf("ParseReply: %v", err)
+	}
+	if text != "검색 결과입니다.\n\n참고하세요." {
+		t.Errorf("text = %q", text)
+	}
+	carousel := tpl.Outputs[0].Carousel
+	if carousel == nil || len(carousel.Items) != 2 {
+		t.Fatalf("carousel = %+v", carousel)
+	}
+	if card, ok := carousel.Items[1].(*BasicCard); !ok || card.Title != "B" {
+		t.Errorf("carousel item = %#v", carousel.Items[1])
+	}
+	if len(tpl.QuickReplies) != 1 || tpl.QuickReplies[0].Label != "더 보기" {
+		t.Errorf("quick replies = %+v", tpl.QuickReplies)
+	}
+}
+
+func TestParseReplyMalformedBlock(t *testing.T) {
+	text, tpl, err := ParseReply("답변\n```kakao\n{not json}\n```")
+	if err == nil || tpl != nil || text != "답변" {
+		t.Errorf("got %q, %v, %v", text, tpl, err)
+	}
+}
+
+func TestRenderReplyLimits(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("본문\n```kakao\n{\"outputs\":[")
+	for i := 0; i < 5; i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"textCard":{"title":"카드"}}`)
+	}
+	b.WriteString("]}\n```")
+
+	s, _ := newTestServer(t)
+	resp := s.renderReply("u1", b.String())
+	if n := len(resp.Template.Outputs); n != maxOutputs {
+		t.Errorf("%d outputs, want %d", n, maxOutputs)
+	}
+	if card := resp.Template.Outputs[0].TextCard; card == nil || card.Description != "본문" {
+		t.Errorf("text not folded into the first card: %+v", resp.Template.Outputs[0])
+	}
+
+	data, _ := json.Marshal(resp)
+	if strings.Contains(string(data), `"basicCard"`) || strings.Contains(string(data), "null") {
+		t.Errorf("unset outputs leaked into JSON: %s", data)
+	}
+}
+
+func TestRenderReplyListLimits(t *testing.T) {
+	items := strings.TrimSuffix(strings.Repeat(`{"title":"항목"},`, 7), ",")
+	buttons := strings.TrimSuffix(strings.Repeat(`{"label":"버튼","action":"message"},`, 4), ",")
+	list := `{"header":{"title":"목록"},"items":[` + items + `],"buttons":[` + buttons + `]}`
+	cards := strings.TrimSuffix(strings.Repeat(list+",", 7), ",")
+	reply := "```kakao\n{\"outputs\":[" +
+		`{"listCard":` + list + `},` +
+		`{"carousel":{"type":"listCard","items":[` + cards + `]}}` +
+		"]}\n```"
+
+	s, _ := newTestServer(t)
+	outputs := s.renderReply("u1", reply).Template.Outputs
+	if len(outputs) != 2 {
+		t.Fatalf("%d outputs, want 2", len(outputs))
+	}
+	if card := outputs[0].ListCard; len(card.Items) != maxListItems || len(card.Buttons) != maxListButtons {
+		t.Errorf("list card has %d items and %d buttons", len(card.Items), len(card.Buttons))
+	}
+	carousel := outputs[1].Carousel
+	if len(carousel.Items) != maxListCarouselSize {
+		t.Errorf("list carousel has %d cards, want %d", len(carousel.Items), maxListCarouselSize)
+	}
+	if card := carousel.Items[0].(*ListCard); len(card.Items) != maxCarouselListItems {
+		t.Errorf("carousel list card has %d items, want %d", len(card.Items), maxCarouselListItems)
+	}
+}
+
+func TestRenderReplyReservesTextSlot(t *testing.T) {
+	reply := "본문\n```kakao\n{\"outputs\":[" +
+		`{"simpleImage":{"imageUrl":"https://example.com/1.png","altText":"1"}},` +
+		`{"simpleImage":{"imageUrl":"https://example.com/2.png","altText":"2"}},` +
+		`{"simpleImage":{"imageUrl":"https://example.com/3.png","altText":"3"}}` +
+		"]}\n```"
+
+	s, _ := newTestServer(t)
+	resp := s.renderReply("u1", reply)
+	if n := len(resp.Template.Outputs); n != maxOutputs {
+		t.Errorf("%d outputs, want %d", n, maxOutputs)
+	}
+	if resp.Template.Outputs[0].SimpleText == nil || resp.Template.Outputs[0].SimpleText.Text != "본문" {
+		t.Errorf("first output = %+v", resp.Template.Outputs[0])
+	}
+	if img := resp.Template.Outputs[2].SimpleImage; img == nil || img.AltText != "2" {
+		t.Errorf("last output = %+v, want the second image", resp.Template.Outputs[2])
+	}
+}
+
+func TestWebhookRichReply(t *testing.T) {
+	s, srv := newTestServer(t)
+	srv.SetChatReply("어떤 걸 도와드릴까요?\n```kakao\n" +
+		`{"outputs":[],"quickReplies":[{"label":"일정","action":"message","messageText":"오늘 일정"}]}` +
+		"\n```")
+
+	_, resp := postWebhook(t, s, "/kakao/webhook", userRequest("u1", "안녕"), nil)
+	if got := resp.Template.Outputs[0].SimpleText.Text; got != "어떤 걸 도와드릴까요?" {
+		t.Errorf("text = %q", got)
+	}
+	if len(resp.Template.QuickReplies) != 1 || resp.Template.QuickReplies[0].MessageText != "오늘 일정" {
+		t.Errorf("quick replies = %+v", resp.Template.QuickReplies)
+	}
+}
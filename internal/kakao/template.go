@@ -0,0 +1,335 @@
+package kakao
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Skill response limits from the Open Builder schema
+const (
+	maxOutputs      = 3
+	maxQuickReplies = 10
+	maxCarouselSize = 10
+	maxButtons      = 3
+	// List cards have tighter limits, tighter still inside a carousel
+	maxListItems         = 5
+	maxListButtons       = 2
+	maxListCarouselSize  = 5
+	maxCarouselListItems = 4
+)
+
+// Link opens a URL, optionally per platform
+type Link struct {
+	Web    string `json:"web,omitempty"`
+	Mobile string `json:"mobile,omitempty"`
+	PC     string `json:"pc,omitempty"`
+}
+
+// Thumbnail is the image of a card
+type Thumbnail struct {
+	ImageURL   string `json:"imageUrl"`
+	Link       *Link  `json:"link,omitempty"`
+	FixedRatio bool   `json:"fixedRatio,omitempty"`
+}
+
+// Button is a card button. Action is one of "webLink", "message", "phone",
+// "block", "share" or "operator".
+type Button struct {
+	Label       string                 `json:"label"`
+	Action      string                 `json:"action"`
+	WebLinkURL  string                 `json:"webLinkUrl,omitempty"`
+	MessageText string                 `json:"messageText,omitempty"`
+	PhoneNumber string                 `json:"phoneNumber,omitempty"`
+	BlockID     string                 `json:"blockId,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// QuickReply is a reply suggestion shown below the outputs. Action is
+// "message" or "block".
+type QuickReply struct {
+	Label       string                 `json:"label"`
+	Action      string                 `json:"action"`
+	MessageText string                 `json:"messageText,omitempty"`
+	BlockID     string                 `json:"blockId,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// SimpleText represents simple text output
+type SimpleText struct {
+	Text string `json:"text"`
+}
+
+// SimpleImage is a single image output
+type SimpleImage struct {
+	ImageURL string `json:"imageUrl"`
+	AltText  string `json:"altText"`
+}
+
+// BasicCard is a card with a thumbnail, text and buttons
+type BasicCard struct {
+	Title        string     `json:"title,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Thumbnail    *Thumbnail `json:"thumbnail,omitempty"`
+	Buttons      []Button   `json:"buttons,omitempty"`
+	ButtonLayout string     `json:"buttonLayout,omitempty"`
+}
+
+// TextCard is a text-only card with buttons
+type TextCard struct {
+	Title        string   `json:"title,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Buttons      []Button `json:"buttons,omitempty"`
+	ButtonLayout string   `json:"buttonLayout,omitempty"`
+}
+
+// ListHeader is the header of a list card
+type ListHeader struct {
+	Title string `json:"title"`
+}
+
+// ListItem is one row of a list card
+type ListItem struct {
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	ImageURL    string                 `json:"imageUrl,omitempty"`
+	Link        *Link                  `json:"link,omitempty"`
+	Action      string                 `json:"action,omitempty"`
+	BlockID     string                 `json:"blockId,omitempty"`
+	MessageText string                 `json:"messageText,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+// ListCard is a titled list of items
+type ListCard struct {
+	Header       ListHeader `json:"header"`
+	Items        []ListItem `json:"items"`
+	Buttons      []Button   `json:"buttons,omitempty"`
+	ButtonLayout string     `json:"buttonLayout,omitempty"`
+}
+
+// ItemHead is the head line of an item card
+type ItemHead struct {
+	Title string `json:"title"`
+}
+
+// ItemImageTitle is the title block of an item card with an optional image
+type ItemImageTitle struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+}
+
+// ItemListEntry is a key/value row of an item card
+type ItemListEntry struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// ItemCard is a card of key/value rows, e.g. a receipt or a schedule
+type ItemCard struct {
+	Thumbnail         *Thumbnail      `json:"thumbnail,omitempty"`
+	Head              *ItemHead       `json:"head,omitempty"`
+	ImageTitle        *ItemImageTitle `json:"imageTitle,omitempty"`
+	ItemList          []ItemListEntry `json:"itemList"`
+	ItemListAlignment string          `json:"itemListAlignment,omitempty"` // "left" or "right"
+	ItemListSummary   *ItemListEntry  `json:"itemListSummary,omitempty"`
+	Title             string          `json:"title,omitempty"`
+	Description       string          `json:"description,omitempty"`
+	Buttons           []Button        `json:"buttons,omitempty"`
+	ButtonLayout      string          `json:"buttonLayout,omitempty"`
+}
+
+// CarouselHeader introduces a carousel
+type CarouselHeader struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Thumbnail   *Thumbnail `json:"thumbnail,omitempty"`
+}
+
+// Carousel shows several cards of the same type side by side. Type is
+// "basicCard", "textCard", "listCard" or "itemCard" and Items holds values
+// of the matching card type.
+type Carousel struct {
+	Type   string          `json:"type"`
+	Header *CarouselHeader `json:"header,omitempty"`
+	Items  []interface{}   `json:"items"`
+}
+
+// UnmarshalJSON decodes the items into the card type named by Type
+func (c *Carousel) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type   string            `json:"type"`
+		Header *CarouselHeader   `json:"header,omitempty"`
+		Items  []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	c.Type = raw.Type
+	c.Header = raw.Header
+	c.Items = make([]interface{}, 0, len(raw.Items))
+	for _, item := range raw.Items {
+		var card interface{}
+		switch raw.Type {
+		case "basicCard":
+			card = &BasicCard{}
+		case "textCard":
+			card = &TextCard{}
+		case "listCard":
+			card = &ListCard{}
+		case "itemCard":
+			card = &ItemCard{}
+		default:
+			return fmt.Errorf("unsupported carousel type %q", raw.Type)
+		}
+		if err := json.Unmarshal(item, card); err != nil {
+			return err
+		}
+		c.Items = append(c.Items, card)
+	}
+	return nil
+}
+
+// trim cuts the carousel and its cards down to Kakao's limits
+func (c *Carousel) trim() {
+	size := maxCarouselSize
+	if c.Type == "listCard" {
+		size = maxListCarouselSize
+	}
+	if len(c.Items) > size {
+		c.Items = c.Items[:size]
+	}
+	for _, item := range c.Items {
+		switch card := item.(type) {
+		case *BasicCard:
+			card.Buttons = limitButtons(card.Buttons, maxButtons)
+		case *TextCard:
+			card.Buttons = limitButtons(card.Buttons, maxButtons)
+		case *ListCard:
+			card.trim(maxCarouselListItems)
+		case *ItemCard:
+			card.Buttons = limitButtons(card.Buttons, maxButtons)
+		}
+	}
+}
+
+// trim cuts the list card down to items rows and Kakao's button limit
+func (l *ListCard) trim(items int) {
+	if len(l.Items) > items {
+		l.Items = l.Items[:items]
+	}
+	l.Buttons = limitButtons(l.Buttons, maxListButtons)
+}
+
+// limitButtons returns at most n of buttons
+func limitButtons(buttons []Button, n int) []Button {
+	if len(buttons) > n {
+		return buttons[:n]
+	}
+	return buttons
+}
+
+// KakaoOutput is one output of a skill response; exactly one field is set
+type KakaoOutput struct {
+	SimpleText  *SimpleText  `json:"simpleText,omitempty"`
+	SimpleImage *SimpleImage `json:"simpleImage,omitempty"`
+	BasicCard   *BasicCard   `json:"basicCard,omitempty"`
+	TextCard    *TextCard    `json:"textCard,omitempty"`
+	ListCard    *ListCard    `json:"listCard,omitempty"`
+	ItemCard    *ItemCard    `json:"itemCard,omitempty"`
+	Carousel    *Carousel    `json:"carousel,omitempty"`
+}
+
+// empty reports whether no output type is set
+func (o KakaoOutput) empty() bool {
+	return o.SimpleText == nil && o.SimpleImage == nil && o.BasicCard == nil &&
+		o.TextCard == nil && o.ListCard == nil && o.ItemCard == nil && o.Carousel == nil
+}
+
+// trim cuts the output down to the limits of its type
+func (o KakaoOutput) trim() {
+	switch {
+	case o.BasicCard != nil:
+		o.BasicCard.Buttons = limitButtons(o.BasicCard.Buttons, maxButtons)
+	case o.TextCard != nil:
+		o.TextCard.Buttons = limitButtons(o.TextCard.Buttons, maxButtons)
+	case o.ListCard != nil:
+		o.ListCard.trim(maxListItems)
+	case o.ItemCard != nil:
+		o.ItemCard.Buttons = limitButtons(o.ItemCard.Buttons, maxButtons)
+	case o.Carousel != nil:
+		o.Carousel.trim()
+	}
+}
+
+// KakaoTemplate represents response template
+type KakaoTemplate struct {
+	Outputs      []KakaoOutput `json:"outputs"`
+	QuickReplies []QuickReply  `json:"quickReplies,omitempty"`
+}
+
+// normalize drops empty outputs and trims the template to Kakao's limits
+func (t *KakaoTemplate) normalize() {
+	outputs := t.Outputs[:0]
+	for _, o := range t.Outputs {
+		if o.empty() {
+			continue
+		}
+		o.trim()
+		outputs = append(outputs, o)
+	}
+	if len(outputs) > maxOutputs {
+		outputs = outputs[:maxOutputs]
+	}
+	t.Outputs = outputs
+
+	if len(t.QuickReplies) > maxQuickReplies {
+		t.QuickReplies = t.QuickReplies[:maxQuickReplies]
+	}
+}
+
+// KakaoData represents callback data
+type KakaoData struct {
+	Text string `json:"text,omitempty"`
+}
+
+// KakaoResponse represents webhook response
+type KakaoResponse struct {
+	Version     string        `json:"version"`
+	UseCallback *bool         `json:"useCallback,omitempty"`
+	Template    KakaoTemplate `json:"template"`
+	Data        *KakaoData    `json:"data,omitempty"`
+}
+
+// TextOutput creates a simpleText output
+func TextOutput(text string) KakaoOutput {
+	return KakaoOutput{SimpleText: &SimpleText{Text: text}}
+}
+
+// NewSimpleTextResponse creates a simple text response
+func NewSimpleTextResponse(text string) *KakaoResponse {
+	return NewTemplateResponse(KakaoTemplate{
+		Outputs: []KakaoOutput{TextOutput(text)},
+	})
+}
+
+// NewTemplateResponse creates a response from a template
+func NewTemplateResponse(template KakaoTemplate) *KakaoResponse {
+	template.normalize()
+	return &KakaoResponse{
+		Version:  "2.0",
+		Template: template,
+	}
+}
+
+// NewCallbackInitialResponse creates initial callback response
+func NewCallbackInitialResponse() *KakaoResponse {
+	useCallback := true
+	return &KakaoResponse{
+		Version:     "2.0",
+		UseCallback: &useCallback,
+		Template:    KakaoTemplate{Outputs: []KakaoOutput{}},
+		Data:        &KakaoData{Text: "처리중입니다..."},
+	}
+}
@@ -0,0 +1,318 @@
+package ollama
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls the response cache in front of /api/chat
+type CacheConfig struct {
+	Enabled    bool
+	TTL        time.Duration
+	MaxEntries int
+	// Sources limits caching to the given request sources; empty means all
+	Sources []Source
+
+	// Semantic enables near-duplicate matching of the last user message
+	// using embeddings, for prompts with the same system prompt
+	Semantic            bool
+	SimilarityThreshold float64
+	EmbedModel          string
+}
+
+// DefaultCacheConfig returns the default (disabled) cache configuration
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		Enabled:             false,
+		TTL:                 time.Hour,
+		MaxEntries:          500,
+		Sources:             []Source{SourceKakao},
+		Semantic:            false,
+		SimilarityThreshold: 0.92,
+		EmbedModel:          DefaultEmbedModel,
+	}
+}
+
+// CacheStats summarizes cache usage
+type CacheStats struct {
+	Enabled      bool   `json:"enabled"`
+	Entries      int    `json:"entries"`
+	Hits         uint64 `json:"hits"`
+	SemanticHits uint64 `json:"semanticHits"`
+	Misses       uint64 `json:"misses"`
+}
+
+// CacheEntry is a cached response as shown to the user
+type CacheEntry struct {
+	Key       string    `json:"key"`
+	Model     string    `json:"model"`
+	Prompt    string    `json:"prompt"`
+	Response  string    `json:"response"`
+	Hits      int       `json:"hits"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type cacheItem struct {
+	entry      CacheEntry
+	contextKey string // hash of the model, earlier messages and options
+	vector     []float32
+}
+
+// embedFunc computes an embedding for the semantic cache
+type embedFunc func(ctx context.Context, model, text string) ([]float32, error)
+
+// ResponseCache is an LRU cache of chat responses with TTL expiry
+type ResponseCache struct {
+	mu      sync.Mutex
+	cfg     CacheConfig
+	items   map[string]*list.Element
+	order   *list.List // front = most recently used
+	stats   CacheStats
+	embedFn embedFunc
+}
+
+// NewResponseCache creates a response cache
+func NewResponseCache(cfg CacheConfig, embed embedFunc) *ResponseCache {
+	return &ResponseCache{
+		cfg:     cfg,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+		embedFn: embed,
+	}
+}
+
+// Configure replaces the cache configuration, dropping entries if disabled
+func (c *ResponseCache) Configure(cfg CacheConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cfg = cfg
+	if !cfg.Enabled {
+		c.flushLocked()
+		return
+	}
+	c.evictLocked()
+}
+
+// applies reports whether a request from src should use the cache
+func (c *ResponseCache) applies(src Source) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.cfg.Enabled {
+		return false
+	}
+	if len(c.cfg.Sources) == 0 {
+		return true
+	}
+	for _, s := range c.cfg.Sources {
+		if s == src {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns a cached response for the request, trying an exact match
+// first and then, if enabled, a semantic match
+func (c *ResponseCache) Lookup(ctx context.Context, req ChatRequest) (string, bool) {
+	key, contextKey, prompt := cacheKeys(req)
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*cacheItem)
+		if time.Now().Before(item.entry.ExpiresAt) {
+			item.entry.Hits++
+			c.order.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return item.entry.Response, true
+		}
+		c.removeLocked(el)
+	}
+	semantic := c.cfg.Semantic && c.embedFn != nil && prompt != ""
+	embedModel := c.cfg.EmbedModel
+	threshold := c.cfg.SimilarityThreshold
+	c.mu.Unlock()
+
+	if semantic {
+		if vec, err := c.embedFn(ctx, embedModel, prompt); err == nil {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			var best *list.Element
+			bestScore := threshold
+			now := time.Now()
+			for el := c.order.Front(); el != nil; el = el.Next() {
+				item := el.Value.(*cacheItem)
+				if item.contextKey != contextKey || item.vector == nil || now.After(item.entry.ExpiresAt) {
+					continue
+				}
+				if score := cosineSimilarity(vec, item.vector); score >= bestScore {
+					best, bestScore = el, score
+				}
+			}
+			if best != nil {
+				item := best.Value.(*cacheItem)
+				item.entry.Hits++
+				c.order.MoveToFront(best)
+				c.stats.SemanticHits++
+				return item.entry.Response, true
+			}
+			c.stats.Misses++
+			return "", false
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+	return "", false
+}
+
+// Store caches a response for the request
+func (c *ResponseCache) Store(ctx context.Context, req ChatRequest, response string) {
+	key, contextKey, prompt := cacheKeys(req)
+
+	c.mu.Lock()
+	semantic := c.cfg.Semantic && c.embedFn != nil && prompt != ""
+	embedModel := c.cfg.EmbedModel
+	c.mu.Unlock()
+
+	var vec []float32
+	if semantic {
+		// Embed outside the lock; the vector is usually on disk already
+		// from the lookup
+		vec, _ = c.embedFn(ctx, embedModel, prompt)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.cfg.Enabled {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.removeLocked(el)
+	}
+
+	now := time.Now()
+	item := &cacheItem{
+		entry: CacheEntry{
+			Key:       key,
+			Model:     req.Model,
+			Prompt:    prompt,
+			Response:  response,
+			CreatedAt: now,
+			ExpiresAt: now.Add(c.cfg.TTL),
+		},
+		contextKey: contextKey,
+		vector:     vec,
+	}
+	c.items[key] = c.order.PushFront(item)
+	c.evictLocked()
+}
+
+// Entries returns the cached entries, most recently used first
+func (c *ResponseCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, c.order.Len())
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		entries = append(entries, el.Value.(*cacheItem).entry)
+	}
+	return entries
+}
+
+// Stats returns cache counters
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Enabled = c.cfg.Enabled
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// Flush drops all entries and resets the counters
+func (c *ResponseCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+	c.stats = CacheStats{}
+}
+
+func (c *ResponseCache) flushLocked() {
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// evictLocked drops expired entries and trims the cache to MaxEntries
+func (c *ResponseCache) evictLocked() {
+	now := time.Now()
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		if now.After(el.Value.(*cacheItem).entry.ExpiresAt) {
+			c.removeLocked(el)
+		}
+		el = prev
+	}
+
+	for c.cfg.MaxEntries > 0 && c.order.Len() > c.cfg.MaxEntries {
+		c.removeLocked(c.order.Back())
+	}
+}
+
+func (c *ResponseCache) removeLocked(el *list.Element) {
+	delete(c.items, el.Value.(*cacheItem).entry.Key)
+	c.order.Remove(el)
+}
+
+// cacheKeys returns the exact-match key, the key of everything before the
+// last user message, and that message's content. The whole conversation
+// identifies a request, so an answer is only reused, exactly or
+// semantically, within an identical conversation.
+func cacheKeys(req ChatRequest) (key, contextKey, prompt string) {
+	messages := req.Messages
+	prefix := messages
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		prompt = messages[n-1].Content
+		prefix = messages[:n-1]
+	}
+
+	key = hashJSON(req.Model, messages, req.Options)
+	contextKey = hashJSON(req.Model, prefix, req.Options)
+	return key, contextKey, prompt
+}
+
+func hashJSON(parts ...interface{}) string {
+	data, _ := json.Marshal(parts)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,245 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEmbedModel is a multilingual embedding model with good Korean support
+	DefaultEmbedModel = "bge-m3"
+
+	embedBatchSize = 32
+)
+
+// Embed computes embeddings for the given inputs using /api/embed.
+// Results are cached on disk by model and content hash, and inputs that are
+// not cached are sent in batches.
+func (m *Manager) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	if model == "" {
+		model = DefaultEmbedModel
+	}
+
+	results := make([][]float32, len(inputs))
+	var missing []int
+	for i, input := range inputs {
+		if vec, ok := m.embedCache.get(model, input); ok {
+			results[i] = vec
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	for start := 0; start < len(missing); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		texts := make([]string, len(batch))
+		for j, idx := range batch {
+			texts[j] = inputs[idx]
+		}
+
+		vectors, err := m.embedBatch(ctx, model, texts)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != len(texts) {
+			return nil, fmt.Errorf("embed returned %d vectors for %d inputs", len(vectors), len(texts))
+		}
+
+		for j, idx := range batch {
+			results[idx] = vectors[j]
+			m.embedCache.put(model, texts[j], vectors[j])
+		}
+	}
+
+	return results, nil
+}
+
+// embedOne computes a single embedding
+func (m *Manager) embedOne(ctx context.Context, model, input string) ([]float32, error) {
+	vectors, err := m.Embed(ctx, model, []string{input})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// embedBatch sends a single /api/embed request
+func (m *Manager) embedBatch(ctx context.Context, model string, inputs []string) (embeddings [][]float32, err error) {
+	start := time.Now()
+	var metrics Metrics
+	defer func() {
+		m.recordUsage(ctx, "embed", model, start, metrics, false, err)
+	}()
+
+	request := map[string]interface{}{
+		"model": model,
+		"input": inputs,
+	}
+	if keepAlive := m.keepAlive(); keepAlive != nil {
+		request["keep_alive"] = keepAlive
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := m.scheduler.Acquire(ctx, SourceFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("embed request not scheduled: %w", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, chatTimeout)
+	defer cancel()
+
+	req, err := m.newRequest(ctx, "POST", "/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embed request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embed failed: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Metrics
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	metrics = result.Metrics
+
+	return result.Embeddings, nil
+}
+
+// EnsureEmbedModel pulls the default embedding model if it is not installed
+func (m *Manager) EnsureEmbedModel() error {
+	models, err := m.ListModels()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range models {
+		if name == DefaultEmbedModel || strings.HasPrefix(name, DefaultEmbedModel+":") {
+			return nil
+		}
+	}
+
+	return m.PullModel(DefaultEmbedModel)
+}
+
+// SetEmbedCacheDir overrides the on-disk embedding cache directory.
+// An empty dir disables the cache.
+func (m *Manager) SetEmbedCacheDir(dir string) {
+	m.embedCache.setDir(dir)
+}
+
+// embedCache stores embeddings on disk, one file per (model, content) pair
+type embedCache struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// defaultEmbedCacheDir returns the default embedding cache directory
+func defaultEmbedCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "dubai-crab", "embeddings")
+}
+
+func (c *embedCache) setDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+}
+
+// path returns the cache file path for a model and input, or "" if the
+// cache is disabled
+func (c *embedCache) path(model, input string) string {
+	c.mu.RLock()
+	dir := c.dir
+	c.mu.RUnlock()
+	if dir == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(model + "\x00" + input))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, key[:2], key+".bin")
+}
+
+func (c *embedCache) get(model, input string) ([]float32, bool) {
+	path := c.path(model, input)
+	if path == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || len(data)%4 != 0 {
+		return nil, false
+	}
+
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vec, true
+}
+
+func (c *embedCache) put(model, input string, vec []float32) {
+	path := c.path(model, input)
+	if path == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	data := make([]byte, len(vec)*4)
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+
+	// Write to a temp file first so concurrent readers never see partial data
+	tmp, err := os.CreateTemp(filepath.Dir(path), "embed-*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
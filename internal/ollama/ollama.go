@@ -17,34 +17,89 @@ import (
 )
 
 const (
-	defaultBaseURL       = "http://localhost:11434"
-	startupTimeout       = 30 * time.Second
-	healthCheckTimeout   = 2 * time.Second
-	chatTimeout          = 120 * time.Second
-	listModelsTimeout    = 10 * time.Second
+	defaultBaseURL     = "http://localhost:11434"
+	startupTimeout     = 30 * time.Second
+	healthCheckTimeout = 2 * time.Second
+	chatTimeout        = 120 * time.Second
+	listModelsTimeout  = 10 * time.Second
 )
 
 // Manager handles Ollama process lifecycle and API calls
 type Manager struct {
-	baseURL string
-	process *exec.Cmd
-	mu      sync.Mutex
-	client  *http.Client
+	settings   Settings
+	settingsMu sync.RWMutex
+	process    *exec.Cmd
+	exited     chan struct{}
+	stop       chan struct{}
+	restarts   int
+	logs       *logBuffer
+	mu         sync.Mutex
+	client     *http.Client
+	longClient *http.Client // no timeout; for pulls and model loads
+	scheduler  *Scheduler
+	embedCache embedCache
+
+	cache       *ResponseCache
+	visionMu    sync.Mutex
+	visionCache map[string]bool
+
+	eventMu sync.RWMutex
+	onEvent EventFunc
+	usage   UsageRecorder
 }
 
 // NewManager creates a new Ollama manager
 func NewManager() *Manager {
-	return &Manager{
-		baseURL: defaultBaseURL,
+	m := &Manager{
+		settings: Settings{BaseURL: defaultBaseURL},
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		longClient:  &http.Client{},
+		scheduler:   NewScheduler(defaultWorkers, DefaultQueueLimits()),
+		embedCache:  embedCache{dir: defaultEmbedCacheDir()},
+		logs:        newLogBuffer(logBufferLines),
+		visionCache: make(map[string]bool),
+	}
+	m.cache = NewResponseCache(DefaultCacheConfig(), m.embedOne)
+	return m
+}
+
+// Scheduler returns the request scheduler that guards /api/chat,
+// /api/generate and /api/embed
+func (m *Manager) Scheduler() *Scheduler {
+	return m.scheduler
+}
+
+// ResponseCache returns the cache used in front of chat requests
+func (m *Manager) ResponseCache() *ResponseCache {
+	return m.cache
+}
+
+// SetEventHandler sets the handler for manager events such as queue
+// positions and process crashes
+func (m *Manager) SetEventHandler(fn EventFunc) {
+	m.eventMu.Lock()
+	m.onEvent = fn
+	m.eventMu.Unlock()
+	m.scheduler.SetEventHandler(fn)
+}
+
+// emit sends an event to the registered handler, if any
+func (m *Manager) emit(name string, data interface{}) {
+	m.eventMu.RLock()
+	fn := m.onEvent
+	m.eventMu.RUnlock()
+	if fn != nil {
+		fn(name, data)
 	}
 }
 
 // SetBaseURL allows overriding the default Ollama URL
 func (m *Manager) SetBaseURL(url string) {
-	m.baseURL = url
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.settings.BaseURL = strings.TrimRight(url, "/")
 }
 
 // Start starts the Ollama server
@@ -57,23 +112,36 @@ func (m *Manager) Start(ctx context.Context) error {
 		return nil
 	}
 
+	// A remote server is not ours to start
+	if !m.IsLocal() {
+		return fmt.Errorf("remote Ollama at %s is not reachable", m.BaseURL())
+	}
+
 	// Find Ollama binary
 	ollamaPath := m.findOllamaPath()
 	if ollamaPath == "" {
 		return fmt.Errorf("ollama not found. Please install Ollama from https://ollama.ai")
 	}
 
-	// Start Ollama serve
-	m.process = exec.CommandContext(ctx, ollamaPath, "serve")
-	m.process.Stdout = io.Discard
-	m.process.Stderr = io.Discard
-
-	if err := m.process.Start(); err != nil {
-		return fmt.Errorf("failed to start Ollama: %w", err)
+	// Start Ollama serve under supervision
+	m.stop = make(chan struct{})
+	m.restarts = 0
+	if err := m.spawnLocked(ctx, ollamaPath, m.stop); err != nil {
+		return err
 	}
 
 	// Wait for server to be ready
-	return m.waitForReady(ctx, startupTimeout)
+	if err := m.waitForReady(ctx, startupTimeout); err != nil {
+		// Don't leave the supervisor respawning a server that never came up
+		close(m.stop)
+		if m.process != nil && m.process.Process != nil {
+			m.process.Process.Kill()
+		}
+		m.process = nil
+		m.logs.Printf("startup failed: %v", err)
+		return err
+	}
+	return nil
 }
 
 // Stop stops the Ollama server
@@ -81,6 +149,11 @@ func (m *Manager) Stop() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Tell the supervisor not to restart
+	if m.stop != nil && !isClosed(m.stop) {
+		close(m.stop)
+	}
+
 	if m.process == nil {
 		return
 	}
@@ -92,18 +165,15 @@ func (m *Manager) Stop() {
 		m.process.Process.Kill()
 	}
 
-	// Wait with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- m.process.Wait()
-	}()
-
+	// Wait with timeout; the supervisor goroutine reaps the process
 	select {
-	case <-done:
+	case <-m.exited:
 	case <-time.After(5 * time.Second):
 		m.process.Process.Kill()
+		<-m.exited
 	}
 
+	m.logs.Printf("process stopped")
 	m.process = nil
 }
 
@@ -112,7 +182,7 @@ func (m *Manager) IsRunning() bool {
 	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", m.baseURL+"/api/tags", nil)
+	req, err := m.newRequest(ctx, "GET", "/api/tags", nil)
 	if err != nil {
 		return false
 	}
@@ -131,7 +201,7 @@ func (m *Manager) ListModels() ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", m.baseURL+"/api/tags", nil)
+	req, err := m.newRequest(ctx, "GET", "/api/tags", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -166,13 +236,13 @@ func (m *Manager) PullModel(name string) error {
 	defer cancel()
 
 	body, _ := json.Marshal(map[string]string{"name": name})
-	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/pull", bytes.NewReader(body))
+	req, err := m.newRequest(ctx, "POST", "/api/pull", bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := m.client.Do(req)
+	// Pulls outlast the default client timeout; the context bounds them
+	resp, err := m.longClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to pull model: %w", err)
 	}
@@ -182,25 +252,52 @@ func (m *Manager) PullModel(name string) error {
 		return fmt.Errorf("failed to pull model: HTTP %d", resp.StatusCode)
 	}
 
+	// The pull only finishes when the progress stream ends with "success"
+	status := ""
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&progress); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to pull model: %w", err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull model: %s", progress.Error)
+		}
+		status = progress.Status
+	}
+	if status != "success" {
+		return fmt.Errorf("failed to pull model: stopped at %q", status)
+	}
+
 	return nil
 }
 
-// ChatMessage represents a chat message
+// ChatMessage represents a chat message. Images holds base64-encoded
+// images for vision-capable models.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
 }
 
 // ChatRequest represents a chat request
 type ChatRequest struct {
-	Model    string        `json:"model"`
-	Messages []ChatMessage `json:"messages"`
-	Stream   bool          `json:"stream"`
+	Model     string                 `json:"model"`
+	Messages  []ChatMessage          `json:"messages"`
+	Stream    bool                   `json:"stream"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
 }
 
 // ChatResponse represents a chat response
 type ChatResponse struct {
 	Message ChatMessage `json:"message"`
+	Metrics
 }
 
 // Chat sends a chat message and returns the response
@@ -219,10 +316,31 @@ func (m *Manager) Chat(ctx context.Context, model, message string, systemPrompt
 		Content: message,
 	})
 
+	return m.ChatMessages(ctx, model, messages)
+}
+
+// ChatMessages sends a full message list and returns the response
+func (m *Manager) ChatMessages(ctx context.Context, model string, messages []ChatMessage) (response string, err error) {
+	start := time.Now()
+	var metrics Metrics
+	cached := false
+	defer func() {
+		m.recordUsage(ctx, "chat", model, start, metrics, cached, err)
+	}()
+
 	request := ChatRequest{
-		Model:    model,
-		Messages: messages,
-		Stream:   false,
+		Model:     model,
+		Messages:  messages,
+		Stream:    false,
+		KeepAlive: m.keepAlive(),
+	}
+
+	useCache := m.cache.applies(SourceFromContext(ctx))
+	if useCache {
+		if response, ok := m.cache.Lookup(ctx, request); ok {
+			cached = true
+			return response, nil
+		}
 	}
 
 	body, err := json.Marshal(request)
@@ -230,14 +348,20 @@ func (m *Manager) Chat(ctx context.Context, model, message string, systemPrompt
 		return "", err
 	}
 
+	// Wait for a worker slot before starting the generation timeout
+	release, err := m.scheduler.Acquire(ctx, SourceFromContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("chat request not scheduled: %w", err)
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(ctx, chatTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/chat", bytes.NewReader(body))
+	req, err := m.newRequest(ctx, "POST", "/api/chat", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := m.client.Do(req)
 	if err != nil {
@@ -253,6 +377,13 @@ func (m *Manager) Chat(ctx context.Context, model, message string, systemPrompt
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	metrics = result.Metrics
+
+	if useCache {
+		// Storing may embed the prompt, which needs a worker slot of its own
+		release()
+		m.cache.Store(ctx, request, result.Message.Content)
+	}
 
 	return result.Message.Content, nil
 }
@@ -314,26 +445,40 @@ func (m *Manager) waitForReady(ctx context.Context, timeout time.Duration) error
 }
 
 // Generate generates text (for simple prompts without chat)
-func (m *Manager) Generate(ctx context.Context, model, prompt string) (string, error) {
+func (m *Manager) Generate(ctx context.Context, model, prompt string) (response string, err error) {
+	start := time.Now()
+	var metrics Metrics
+	defer func() {
+		m.recordUsage(ctx, "generate", model, start, metrics, false, err)
+	}()
+
 	request := map[string]interface{}{
 		"model":  model,
 		"prompt": prompt,
 		"stream": false,
 	}
+	if keepAlive := m.keepAlive(); keepAlive != nil {
+		request["keep_alive"] = keepAlive
+	}
 
 	body, err := json.Marshal(request)
 	if err != nil {
 		return "", err
 	}
 
+	release, err := m.scheduler.Acquire(ctx, SourceFromContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("generate request not scheduled: %w", err)
+	}
+	defer release()
+
 	ctx, cancel := context.WithTimeout(ctx, chatTimeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/generate", bytes.NewReader(body))
+	req, err := m.newRequest(ctx, "POST", "/api/generate", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := m.client.Do(req)
 	if err != nil {
@@ -347,10 +492,12 @@ func (m *Manager) Generate(ctx context.Context, model, prompt string) (string, e
 
 	var result struct {
 		Response string `json:"response"`
+		Metrics
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	metrics = result.Metrics
 
 	return strings.TrimSpace(result.Response), nil
 }
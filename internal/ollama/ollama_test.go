@@ -0,0 +1,405 @@
+package ollama_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"DubaiCrab/internal/ollama"
+	"DubaiCrab/internal/ollama/ollamatest"
+	"DubaiCrab/internal/usage"
+)
+
+func newTestManager(t *testing.T) (*ollama.Manager, *ollamatest.Server) {
+	t.Helper()
+	srv := ollamatest.NewServer()
+	t.Cleanup(srv.Close)
+
+	m := ollama.NewManager()
+	m.Configure(ollama.Settings{BaseURL: srv.URL, KeepAlive: "10m"})
+	m.SetEmbedCacheDir(t.TempDir())
+	return m, srv
+}
+
+func TestChat(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.SetChatReply("안녕하세요")
+
+	system := "system prompt"
+	got, err := m.Chat(context.Background(), "qwen2.5:0.5b", "hello", &system)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if got != "안녕하세요" {
+		t.Errorf("Chat = %q, want %q", got, "안녕하세요")
+	}
+
+	reqs := srv.ChatRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d chat requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "hello" {
+		t.Errorf("unexpected messages: %+v", req.Messages)
+	}
+	if req.Stream == nil || *req.Stream {
+		t.Errorf("expected non-streaming request")
+	}
+	if req.KeepAlive != "10m" {
+		t.Errorf("keep_alive = %v, want 10m", req.KeepAlive)
+	}
+}
+
+type usageRecorder struct {
+	mu      sync.Mutex
+	records []usage.Record
+}
+
+func (r *usageRecorder) Record(rec usage.Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+}
+
+func TestChatRecordsUsage(t *testing.T) {
+	m, srv := newTestManager(t)
+	rec := &usageRecorder{}
+	m.SetUsageRecorder(rec)
+	srv.SetUsage(ollamatest.Usage{PromptEvalCount: 12, EvalCount: 34, EvalDuration: 2 * time.Second})
+
+	kakao := ollama.WithSource(context.Background(), ollama.SourceKakao)
+	m.Chat(kakao, "qwen2.5:0.5b", "hello", nil)
+	srv.FailNext("/api/chat", http.StatusInternalServerError, 1)
+	m.Chat(context.Background(), "qwen2.5:0.5b", "hello", nil)
+
+	if len(rec.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(rec.records))
+	}
+	ok := rec.records[0]
+	if ok.Source != "kakao" || ok.Model != "qwen2.5:0.5b" || ok.PromptTokens != 12 || ok.EvalTokens != 34 || ok.EvalMs != 2000 || ok.Error != "" {
+		t.Errorf("success record = %+v", ok)
+	}
+	if failed := rec.records[1]; failed.Source != "desktop" || failed.Error == "" {
+		t.Errorf("error record = %+v", failed)
+	}
+}
+
+func TestEmbedRecordsUsage(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.SetEmbedCacheDir("")
+	rec := &usageRecorder{}
+	m.SetUsageRecorder(rec)
+
+	kakao := ollama.WithSource(context.Background(), ollama.SourceKakao)
+	if _, err := m.Embed(kakao, "", []string{"연차", "병가"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.records) != 1 {
+		t.Fatalf("got %d records, want 1", len(rec.records))
+	}
+	if r := rec.records[0]; r.Kind != "embed" || r.Source != "kakao" || r.Model != ollama.DefaultEmbedModel || r.PromptTokens != 2 {
+		t.Errorf("embed record = %+v", r)
+	}
+}
+
+func TestChatHTTPError(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.FailNext("/api/chat", http.StatusInternalServerError, 1)
+
+	if _, err := m.Chat(context.Background(), "qwen2.5:0.5b", "hello", nil); err == nil {
+		t.Fatal("expected error for HTTP 500")
+	}
+	if _, err := m.Chat(context.Background(), "qwen2.5:0.5b", "hello", nil); err != nil {
+		t.Fatalf("second Chat: %v", err)
+	}
+}
+
+func TestChatTimeout(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.SetLatency("/api/chat", time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := m.Chat(ctx, "qwen2.5:0.5b", "hello", nil); err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func TestListModels(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.SetModels("a:latest", "b:7b")
+
+	models, err := m.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 || models[0] != "a:latest" || models[1] != "b:7b" {
+		t.Errorf("ListModels = %v", models)
+	}
+}
+
+func TestAuthHeaders(t *testing.T) {
+	m, srv := newTestManager(t)
+
+	m.Configure(ollama.Settings{BaseURL: srv.URL, Username: "user", Password: "pass"})
+	m.ListModels()
+	m.Configure(ollama.Settings{BaseURL: srv.URL, BearerToken: "token"})
+	m.ListModels()
+
+	reqs := srv.Requests("/api/tags")
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if got := reqs[0].Header.Get("Authorization"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("basic auth header = %q", got)
+	}
+	if got := reqs[1].Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("bearer auth header = %q", got)
+	}
+}
+
+func TestEmbedBatchesAndCaches(t *testing.T) {
+	m, srv := newTestManager(t)
+
+	inputs := make([]string, 40)
+	for i := range inputs {
+		inputs[i] = fmt.Sprintf("문장 %d", i)
+	}
+
+	vectors, err := m.Embed(context.Background(), "", inputs)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != len(inputs) {
+		t.Fatalf("got %d vectors, want %d", len(vectors), len(inputs))
+	}
+	if got := len(srv.Requests("/api/embed")); got != 2 {
+		t.Errorf("got %d embed requests, want 2 batches", got)
+	}
+
+	want := ollamatest.HashEmbedding(inputs[3])
+	for i := range want {
+		if vectors[3][i] != want[i] {
+			t.Fatalf("vector mismatch at %d: %v != %v", i, vectors[3], want)
+		}
+	}
+
+	// Everything is cached now
+	if _, err := m.Embed(context.Background(), "", inputs); err != nil {
+		t.Fatalf("Embed (cached): %v", err)
+	}
+	if got := len(srv.Requests("/api/embed")); got != 2 {
+		t.Errorf("cached Embed sent requests: %d total", got)
+	}
+}
+
+func TestEnsureEmbedModel(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	if err := m.EnsureEmbedModel(); err != nil {
+		t.Fatalf("EnsureEmbedModel: %v", err)
+	}
+	models, _ := m.ListModels()
+	found := false
+	for _, name := range models {
+		found = found || name == ollama.DefaultEmbedModel
+	}
+	if !found {
+		t.Errorf("embed model not installed: %v", models)
+	}
+}
+
+func TestPullModelStreamError(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.SetPullError("no space left on device")
+
+	if err := m.PullModel("bge-m3"); err == nil {
+		t.Error("expected pull error from the progress stream")
+	}
+}
+
+func TestEmbedCacheDirConcurrent(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.SetEmbedCacheDir(t.TempDir())
+			m.Embed(context.Background(), "", []string{fmt.Sprintf("문장 %d", i)})
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLoadedModelsAndUnload(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	if err := m.Preload("qwen2.5:0.5b"); err != nil {
+		t.Fatalf("Preload: %v", err)
+	}
+	loaded, err := m.LoadedModels()
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("LoadedModels = %v, %v", loaded, err)
+	}
+
+	if err := m.Unload("qwen2.5:0.5b"); err != nil {
+		t.Fatalf("Unload: %v", err)
+	}
+	loaded, _ = m.LoadedModels()
+	if len(loaded) != 0 {
+		t.Errorf("model still loaded after Unload: %v", loaded)
+	}
+}
+
+func TestResidencyErrorsNameTheAction(t *testing.T) {
+	m, srv := newTestManager(t)
+
+	srv.FailNext("/api/generate", http.StatusInternalServerError, 1)
+	if err := m.Preload("qwen2.5:0.5b"); err == nil || !strings.Contains(err.Error(), "failed to load") {
+		t.Errorf("Preload error = %v", err)
+	}
+	srv.FailNext("/api/generate", http.StatusInternalServerError, 1)
+	if err := m.Unload("qwen2.5:0.5b"); err == nil || !strings.Contains(err.Error(), "failed to unload") {
+		t.Errorf("Unload error = %v", err)
+	}
+}
+
+func TestSchedulerLimitsConcurrency(t *testing.T) {
+	m, srv := newTestManager(t)
+	srv.SetLatency("/api/chat", 30*time.Millisecond)
+	m.Scheduler().Configure(1, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Chat(context.Background(), "qwen2.5:0.5b", "hi", nil); err != nil {
+				t.Errorf("Chat: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := srv.MaxInflight(); got != 1 {
+		t.Errorf("max in-flight requests = %d, want 1", got)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	m, srv := newTestManager(t)
+	cfg := ollama.DefaultCacheConfig()
+	cfg.Enabled = true
+	m.ResponseCache().Configure(cfg)
+
+	kakao := ollama.WithSource(context.Background(), ollama.SourceKakao)
+	for i := 0; i < 3; i++ {
+		if _, err := m.Chat(kakao, "qwen2.5:0.5b", "연차 신청 어떻게 해요?", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(srv.ChatRequests()); got != 1 {
+		t.Errorf("got %d chat requests, want 1", got)
+	}
+
+	// Desktop traffic is not cached by default
+	m.Chat(context.Background(), "qwen2.5:0.5b", "연차 신청 어떻게 해요?", nil)
+	if got := len(srv.ChatRequests()); got != 2 {
+		t.Errorf("got %d chat requests, want 2", got)
+	}
+
+	stats := m.ResponseCache().Stats()
+	if stats.Hits != 2 || stats.Entries != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestResponseCacheKeysOnHistory(t *testing.T) {
+	m, srv := newTestManager(t)
+	cfg := ollama.DefaultCacheConfig()
+	cfg.Enabled = true
+	m.ResponseCache().Configure(cfg)
+
+	kakao := ollama.WithSource(context.Background(), ollama.SourceKakao)
+	system := ollama.ChatMessage{Role: "system", Content: "회사 비서"}
+	followUp := ollama.ChatMessage{Role: "user", Content: "더 자세히"}
+	conversation := func(topic string) []ollama.ChatMessage {
+		return []ollama.ChatMessage{
+			system,
+			{Role: "user", Content: topic},
+			{Role: "assistant", Content: topic + " 답변"},
+			followUp,
+		}
+	}
+
+	m.ChatMessages(kakao, "qwen2.5:0.5b", conversation("연차 신청"))
+	m.ChatMessages(kakao, "qwen2.5:0.5b", conversation("연차 신청"))
+	if got := len(srv.ChatRequests()); got != 1 {
+		t.Errorf("got %d chat requests for the same conversation, want 1", got)
+	}
+
+	// The same follow-up in another conversation is a different question
+	m.ChatMessages(kakao, "qwen2.5:0.5b", conversation("급여 명세서"))
+	if got := len(srv.ChatRequests()); got != 2 {
+		t.Errorf("got %d chat requests, want 2", got)
+	}
+}
+
+func TestSemanticResponseCache(t *testing.T) {
+	m, srv := newTestManager(t)
+	// Every input maps to the same direction, so any prompt is "similar"
+	srv.SetEmbedFunc(func(string) []float32 { return []float32{1, 0, 0} })
+
+	cfg := ollama.DefaultCacheConfig()
+	cfg.Enabled = true
+	cfg.Semantic = true
+	m.ResponseCache().Configure(cfg)
+
+	kakao := ollama.WithSource(context.Background(), ollama.SourceKakao)
+	m.Chat(kakao, "qwen2.5:0.5b", "연차 신청 어떻게 해요?", nil)
+	got, err := m.Chat(kakao, "qwen2.5:0.5b", "연차는 어떻게 신청하나요?", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "echo: 연차 신청 어떻게 해요?" {
+		t.Errorf("semantic hit returned %q", got)
+	}
+	if m.ResponseCache().Stats().SemanticHits != 1 {
+		t.Errorf("stats = %+v", m.ResponseCache().Stats())
+	}
+}
+
+func TestSemanticResponseCacheSingleWorker(t *testing.T) {
+	m, srv := newTestManager(t)
+	// Without the on-disk embed cache, storing has to call /api/embed again
+	m.SetEmbedCacheDir("")
+	m.Scheduler().Configure(1, nil)
+
+	cfg := ollama.DefaultCacheConfig()
+	cfg.Enabled = true
+	cfg.Semantic = true
+	m.ResponseCache().Configure(cfg)
+
+	ctx, cancel := context.WithTimeout(ollama.WithSource(context.Background(), ollama.SourceKakao), 2*time.Second)
+	defer cancel()
+	if _, err := m.Chat(ctx, "qwen2.5:0.5b", "연차 신청 어떻게 해요?", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("chat blocked on its own worker slot while storing")
+	}
+	if n := len(srv.Requests("/api/embed")); n != 2 {
+		t.Errorf("embed requests = %d, want 2", n)
+	}
+	if stats := m.ResponseCache().Stats(); stats.Entries != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,566 @@
+// Package ollamatest provides an in-process fake Ollama server for tests.
+//
+// The server implements the subset of the Ollama API the app uses, with
+// scripted responses, injected latency and injected errors:
+//
+//	srv := ollamatest.NewServer()
+//	defer srv.Close()
+//	srv.SetChatReply("안녕하세요")
+//	srv.FailNext("/api/chat", http.StatusInternalServerError, 1)
+//
+//	m := ollama.NewManager()
+//	m.SetBaseURL(srv.URL)
+package ollamatest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a chat message as received by the fake server
+type Message struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+// ChatRequest is a decoded /api/chat request
+type ChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []Message              `json:"messages"`
+	Stream    *bool                  `json:"stream,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+}
+
+// ChatFunc produces the reply for a chat request
+type ChatFunc func(req ChatRequest) string
+
+// Request is a request recorded by the server
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Usage is reported in the final chat/generate chunk
+type Usage struct {
+	PromptEvalCount    int
+	EvalCount          int
+	TotalDuration      time.Duration
+	LoadDuration       time.Duration
+	PromptEvalDuration time.Duration
+	EvalDuration       time.Duration
+}
+
+type failure struct {
+	status int
+	count  int
+}
+
+// Server is a fake Ollama server backed by httptest
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	models       []string
+	loaded       []string
+	capabilities map[string][]string
+	chatFn       ChatFunc
+	generateFn   func(prompt string) string
+	embedFn      func(input string) []float32
+	pullError    string
+	usage        Usage
+	latency      map[string]time.Duration
+	failures     map[string]*failure
+	requests     []Request
+	inflight     int
+	maxInflight  int
+}
+
+// NewServer starts a fake server with one installed model and an echo reply
+func NewServer() *Server {
+	s := &Server{
+		models:       []string{"qwen2.5:0.5b"},
+		capabilities: make(map[string][]string),
+		chatFn: func(req ChatRequest) string {
+			if n := len(req.Messages); n > 0 {
+				return "echo: " + req.Messages[n-1].Content
+			}
+			return ""
+		},
+		generateFn: func(prompt string) string { return "echo: " + prompt },
+		embedFn:    HashEmbedding,
+		usage: Usage{
+			PromptEvalCount:    10,
+			EvalCount:          20,
+			TotalDuration:      100 * time.Millisecond,
+			LoadDuration:       10 * time.Millisecond,
+			PromptEvalDuration: 20 * time.Millisecond,
+			EvalDuration:       70 * time.Millisecond,
+		},
+		latency:  make(map[string]time.Duration),
+		failures: make(map[string]*failure),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tags", s.handleTags)
+	mux.HandleFunc("/api/ps", s.handlePs)
+	mux.HandleFunc("/api/chat", s.handleChat)
+	mux.HandleFunc("/api/generate", s.handleGenerate)
+	mux.HandleFunc("/api/pull", s.handlePull)
+	mux.HandleFunc("/api/embed", s.handleEmbed)
+	mux.HandleFunc("/api/show", s.handleShow)
+
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// SetModels replaces the list of installed models
+func (s *Server) SetModels(models ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = models
+}
+
+// SetCapabilities sets the capabilities reported by /api/show for a model
+func (s *Server) SetCapabilities(model string, capabilities ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capabilities[model] = capabilities
+}
+
+// SetChatReply makes every chat request return text
+func (s *Server) SetChatReply(text string) {
+	s.SetChatFunc(func(ChatRequest) string { return text })
+}
+
+// SetChatFunc scripts chat replies
+func (s *Server) SetChatFunc(fn ChatFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chatFn = fn
+}
+
+// SetGenerateFunc scripts /api/generate replies
+func (s *Server) SetGenerateFunc(fn func(prompt string) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generateFn = fn
+}
+
+// SetEmbedFunc scripts embeddings
+func (s *Server) SetEmbedFunc(fn func(input string) []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedFn = fn
+}
+
+// SetPullError makes pulls fail with msg partway through the progress stream
+func (s *Server) SetPullError(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pullError = msg
+}
+
+// SetUsage sets the token counts and durations reported for generations
+func (s *Server) SetUsage(u Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = u
+}
+
+// SetLatency delays every response on path by d
+func (s *Server) SetLatency(path string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[path] = d
+}
+
+// FailNext makes the next n requests on path fail with status
+func (s *Server) FailNext(path string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = &failure{status: status, count: n}
+}
+
+// Requests returns the recorded requests for path, or all if path is empty
+func (s *Server) Requests(path string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Request
+	for _, r := range s.requests {
+		if path == "" || r.Path == path {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// ChatRequests returns the decoded /api/chat requests
+func (s *Server) ChatRequests() []ChatRequest {
+	var out []ChatRequest
+	for _, r := range s.Requests("/api/chat") {
+		var req ChatRequest
+		if json.Unmarshal(r.Body, &req) == nil {
+			out = append(out, req)
+		}
+	}
+	return out
+}
+
+// MaxInflight returns the highest number of concurrent requests seen
+func (s *Server) MaxInflight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInflight
+}
+
+// HashEmbedding is a deterministic 8-dimensional embedding of input
+func HashEmbedding(input string) []float32 {
+	sum := sha256.Sum256([]byte(input))
+	vec := make([]float32, 8)
+	for i := range vec {
+		vec[i] = float32(binary.LittleEndian.Uint32(sum[i*4:])%1000) / 1000
+	}
+	return vec
+}
+
+// middleware records requests and applies injected latency and errors
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		s.inflight++
+		if s.inflight > s.maxInflight {
+			s.maxInflight = s.inflight
+		}
+		delay := s.latency[r.URL.Path]
+		var status int
+		if f := s.failures[r.URL.Path]; f != nil && f.count > 0 {
+			f.count--
+			status = f.status
+		}
+		s.mu.Unlock()
+
+		defer func() {
+			s.mu.Lock()
+			s.inflight--
+			s.mu.Unlock()
+		}()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if status != 0 {
+			writeJSON(w, status, map[string]string{"error": http.StatusText(status)})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	models := make([]map[string]interface{}, len(s.models))
+	for i, name := range s.models {
+		models[i] = map[string]interface{}{"name": name, "model": name}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": models})
+}
+
+func (s *Server) handlePs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	models := make([]map[string]interface{}, len(s.loaded))
+	for i, name := range s.loaded {
+		models[i] = map[string]interface{}{
+			"name":       name,
+			"model":      name,
+			"expires_at": time.Now().Add(5 * time.Minute),
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": models})
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !s.hasModel(req.Model) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "model '" + req.Model + "' not found"})
+		return
+	}
+	s.markLoaded(req.Model, req.KeepAlive)
+
+	s.mu.Lock()
+	chatFn := s.chatFn
+	s.mu.Unlock()
+	reply := chatFn(req)
+
+	// Ollama streams by default
+	if req.Stream == nil || *req.Stream {
+		s.stream(w, reply, func(chunk string, done bool) map[string]interface{} {
+			return map[string]interface{}{
+				"model":   req.Model,
+				"message": map[string]string{"role": "assistant", "content": chunk},
+				"done":    done,
+			}
+		})
+		return
+	}
+
+	resp := s.final(map[string]interface{}{
+		"model":   req.Model,
+		"message": map[string]string{"role": "assistant", "content": reply},
+	})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model     string      `json:"model"`
+		Prompt    string      `json:"prompt"`
+		Stream    *bool       `json:"stream,omitempty"`
+		KeepAlive interface{} `json:"keep_alive,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !s.hasModel(req.Model) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "model '" + req.Model + "' not found"})
+		return
+	}
+	s.markLoaded(req.Model, req.KeepAlive)
+
+	// An empty prompt only loads or unloads the model
+	if req.Prompt == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"model": req.Model, "response": "", "done": true})
+		return
+	}
+
+	s.mu.Lock()
+	generateFn := s.generateFn
+	s.mu.Unlock()
+	reply := generateFn(req.Prompt)
+
+	if req.Stream == nil || *req.Stream {
+		s.stream(w, reply, func(chunk string, done bool) map[string]interface{} {
+			return map[string]interface{}{"model": req.Model, "response": chunk, "done": done}
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.final(map[string]interface{}{"model": req.Model, "response": reply}))
+}
+
+func (s *Server) handlePull(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	name := req.Model
+	if name == "" {
+		name = req.Name
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	s.mu.Lock()
+	pullError := s.pullError
+	s.mu.Unlock()
+	if pullError != "" {
+		enc.Encode(map[string]string{"status": "pulling manifest"})
+		enc.Encode(map[string]string{"error": pullError})
+		return
+	}
+	for _, status := range []string{"pulling manifest", "verifying sha256 digest", "writing manifest", "success"} {
+		enc.Encode(map[string]string{"status": status})
+	}
+
+	if !s.hasModel(name) {
+		s.mu.Lock()
+		s.models = append(s.models, name)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) handleEmbed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string      `json:"model"`
+		Input interface{} `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var inputs []string
+	switch v := req.Input.(type) {
+	case string:
+		inputs = []string{v}
+	case []interface{}:
+		for _, in := range v {
+			text, _ := in.(string)
+			inputs = append(inputs, text)
+		}
+	}
+
+	s.mu.Lock()
+	embedFn := s.embedFn
+	s.mu.Unlock()
+
+	embeddings := make([][]float32, len(inputs))
+	for i, in := range inputs {
+		embeddings[i] = embedFn(in)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"model":             req.Model,
+		"embeddings":        embeddings,
+		"prompt_eval_count": len(inputs),
+	})
+}
+
+func (s *Server) handleShow(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	name := req.Model
+	if name == "" {
+		name = req.Name
+	}
+	if !s.hasModel(name) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "model '" + name + "' not found"})
+		return
+	}
+
+	s.mu.Lock()
+	caps, ok := s.capabilities[name]
+	s.mu.Unlock()
+	if !ok {
+		caps = []string{"completion"}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"capabilities": caps,
+		"details":      map[string]interface{}{"family": "qwen2", "families": []string{"qwen2"}},
+	})
+}
+
+// stream writes reply as NDJSON chunks followed by a final done chunk
+func (s *Server) stream(w http.ResponseWriter, reply string, chunk func(text string, done bool) map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if word == "" {
+			continue
+		}
+		enc.Encode(chunk(word, false))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	enc.Encode(s.final(chunk("", true)))
+}
+
+// final adds done and usage fields to a response
+func (s *Server) final(resp map[string]interface{}) map[string]interface{} {
+	s.mu.Lock()
+	u := s.usage
+	s.mu.Unlock()
+
+	resp["done"] = true
+	resp["done_reason"] = "stop"
+	resp["created_at"] = time.Now().UTC()
+	resp["prompt_eval_count"] = u.PromptEvalCount
+	resp["eval_count"] = u.EvalCount
+	resp["total_duration"] = u.TotalDuration.Nanoseconds()
+	resp["load_duration"] = u.LoadDuration.Nanoseconds()
+	resp["prompt_eval_duration"] = u.PromptEvalDuration.Nanoseconds()
+	resp["eval_duration"] = u.EvalDuration.Nanoseconds()
+	return resp
+}
+
+func (s *Server) hasModel(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.models {
+		if m == name || strings.TrimSuffix(m, ":latest") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// markLoaded tracks which models /api/ps reports, honoring keep_alive 0
+func (s *Server) markLoaded(model string, keepAlive interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unload := false
+	switch v := keepAlive.(type) {
+	case float64:
+		unload = v == 0
+	case string:
+		unload = v == "0" || v == "0s"
+	}
+
+	for i, m := range s.loaded {
+		if m == model {
+			if unload {
+				s.loaded = append(s.loaded[:i], s.loaded[i+1:]...)
+			}
+			return
+		}
+	}
+	if !unload {
+		s.loaded = append(s.loaded, model)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,145 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const loadTimeout = 5 * time.Minute
+
+// LoadedModel describes a model currently held in memory by Ollama
+type LoadedModel struct {
+	Name      string    `json:"name"`
+	Model     string    `json:"model"`
+	Size      int64     `json:"size"`
+	SizeVRAM  int64     `json:"size_vram"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// keepAliveValue converts a configured keep-alive into the API form:
+// plain integers are seconds (-1 keeps the model loaded indefinitely),
+// anything else is sent as a duration string such as "30m"
+func keepAliveValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return s
+}
+
+// keepAlive returns the configured per-request keep-alive
+func (m *Manager) keepAlive() interface{} {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+	return keepAliveValue(m.settings.KeepAlive)
+}
+
+// LoadedModels lists the models Ollama currently has in memory (/api/ps)
+func (m *Manager) LoadedModels() ([]LoadedModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+
+	req, err := m.newRequest(ctx, "GET", "/api/ps", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list loaded models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list loaded models: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Models []LoadedModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Models, nil
+}
+
+// Preload loads a model into memory with the configured keep-alive
+func (m *Manager) Preload(model string) error {
+	return m.setResidency(model, m.keepAlive())
+}
+
+// Unload evicts a model from memory immediately
+func (m *Manager) Unload(model string) error {
+	return m.setResidency(model, 0)
+}
+
+// WarmUp preloads each distinct model, logging failures
+func (m *Manager) WarmUp(models ...string) {
+	seen := make(map[string]bool)
+	for _, model := range models {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+
+		start := time.Now()
+		if err := m.Preload(model); err != nil {
+			log.Printf("[ollama] Warm-up of %s failed: %v", model, err)
+			continue
+		}
+		log.Printf("[ollama] Warmed up %s in %s", model, time.Since(start).Round(time.Millisecond))
+		m.emit("ollama:warm", model)
+	}
+}
+
+// setResidency sends an empty generate request, which only loads or
+// unloads the model depending on keep_alive
+func (m *Manager) setResidency(model string, keepAlive interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+
+	request := map[string]interface{}{
+		"model": model,
+	}
+	if keepAlive != nil {
+		request["keep_alive"] = keepAlive
+	}
+
+	// A keep-alive of 0 unloads the model
+	action := "load"
+	if keepAlive == 0 {
+		action = "unload"
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := m.newRequest(ctx, "POST", "/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	// Large models take minutes to load; loadTimeout bounds the request
+	resp, err := m.longClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to %s model: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to %s model %s: HTTP %d", action, model, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Source identifies where an LLM request originated
+type Source string
+
+const (
+	SourceDesktop Source = "desktop"
+	SourceKakao   Source = "kakao"
+	SourceRelay   Source = "relay"
+	SourceBatch   Source = "batch"
+)
+
+// Priority determines the order in which queued requests are served.
+// Higher values are served first.
+type Priority int
+
+const (
+	PriorityBatch Priority = iota
+	PriorityMessenger
+	PriorityInteractive
+
+	numPriorities = int(PriorityInteractive) + 1
+)
+
+const defaultWorkers = 1
+
+// ErrQueueFull is returned when a source already has the maximum number of
+// requests waiting in the queue
+var ErrQueueFull = errors.New("ollama request queue is full")
+
+// DefaultQueueLimits returns the default per-source max queue depth
+func DefaultQueueLimits() map[Source]int {
+	return map[Source]int{
+		SourceDesktop: 4,
+		SourceKakao:   16,
+		SourceRelay:   8,
+		SourceBatch:   32,
+	}
+}
+
+// PriorityOf returns the scheduling priority for a source
+func PriorityOf(src Source) Priority {
+	switch src {
+	case SourceDesktop:
+		return PriorityInteractive
+	case SourceKakao, SourceRelay:
+		return PriorityMessenger
+	default:
+		return PriorityBatch
+	}
+}
+
+type sourceKey struct{}
+
+// WithSource tags a context with the request source used for scheduling
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// SourceFromContext returns the request source, defaulting to desktop
+func SourceFromContext(ctx context.Context) Source {
+	if src, ok := ctx.Value(sourceKey{}).(Source); ok && src != "" {
+		return src
+	}
+	return SourceDesktop
+}
+
+// EventFunc receives scheduler and process events (e.g. for the UI)
+type EventFunc func(name string, data interface{})
+
+// QueueEvent reports the position of a waiting request
+type QueueEvent struct {
+	ID       uint64 `json:"id"`
+	Source   Source `json:"source"`
+	Position int    `json:"position"` // 1-based, 0 once the request starts
+	Queued   int    `json:"queued"`
+}
+
+// ticket is a queued request waiting for a worker
+type ticket struct {
+	id     uint64
+	source Source
+	ready  chan struct{}
+}
+
+// Scheduler limits concurrent Ollama requests with a bounded worker pool
+// and serves waiting requests by priority, FIFO within a priority
+type Scheduler struct {
+	mu      sync.Mutex
+	workers int
+	active  int
+	limits  map[Source]int
+	depth   map[Source]int
+	queues  [numPriorities][]*ticket
+	nextID  uint64
+	onEvent EventFunc
+}
+
+// NewScheduler creates a scheduler with the given number of workers
+func NewScheduler(workers int, limits map[Source]int) *Scheduler {
+	s := &Scheduler{
+		depth: make(map[Source]int),
+	}
+	s.Configure(workers, limits)
+	return s
+}
+
+// Configure updates the worker count and per-source queue limits.
+// A limit of 0 (or a missing source) means unlimited.
+func (s *Scheduler) Configure(workers int, limits map[Source]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	s.workers = workers
+
+	s.limits = make(map[Source]int, len(limits))
+	for src, n := range limits {
+		s.limits[src] = n
+	}
+
+	// More workers may have become available
+	s.dispatchLocked()
+}
+
+// SetEventHandler sets the handler that receives queue position events
+func (s *Scheduler) SetEventHandler(fn EventFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEvent = fn
+}
+
+// Acquire blocks until a worker is available for the request or ctx is done.
+// The returned release function must be called when the request finishes.
+func (s *Scheduler) Acquire(ctx context.Context, src Source) (func(), error) {
+	s.mu.Lock()
+
+	if s.active < s.workers && s.queuedLocked() == 0 {
+		s.active++
+		s.mu.Unlock()
+		return s.releaseFunc(), nil
+	}
+
+	if limit := s.limits[src]; limit > 0 && s.depth[src] >= limit {
+		s.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	s.nextID++
+	t := &ticket{id: s.nextID, source: src, ready: make(chan struct{})}
+	prio := PriorityOf(src)
+	s.queues[prio] = append(s.queues[prio], t)
+	s.depth[src]++
+	s.emitPositionsLocked()
+	s.mu.Unlock()
+
+	select {
+	case <-t.ready:
+		return s.releaseFunc(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-t.ready:
+			// Dispatched concurrently with cancellation; hand the slot on
+			s.active--
+			s.dispatchLocked()
+		default:
+			s.removeLocked(t)
+			s.emitPositionsLocked()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns the number of active and queued requests
+func (s *Scheduler) Stats() (active, queued int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active, s.queuedLocked()
+}
+
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.active--
+			s.dispatchLocked()
+		})
+	}
+}
+
+// dispatchLocked hands free workers to the highest priority waiting tickets
+func (s *Scheduler) dispatchLocked() {
+	dispatched := false
+	for s.active < s.workers {
+		t := s.popLocked()
+		if t == nil {
+			break
+		}
+		s.active++
+		s.depth[t.source]--
+		s.emitLocked(QueueEvent{ID: t.id, Source: t.source, Position: 0, Queued: s.queuedLocked()})
+		close(t.ready)
+		dispatched = true
+	}
+	if dispatched {
+		s.emitPositionsLocked()
+	}
+}
+
+func (s *Scheduler) popLocked() *ticket {
+	for p := numPriorities - 1; p >= 0; p-- {
+		if len(s.queues[p]) > 0 {
+			t := s.queues[p][0]
+			s.queues[p] = s.queues[p][1:]
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) removeLocked(t *ticket) {
+	prio := PriorityOf(t.source)
+	q := s.queues[prio]
+	for i, qt := range q {
+		if qt == t {
+			s.queues[prio] = append(q[:i], q[i+1:]...)
+			s.depth[t.source]--
+			return
+		}
+	}
+}
+
+func (s *Scheduler) queuedLocked() int {
+	n := 0
+	for _, q := range s.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// emitPositionsLocked reports the current position of every waiting ticket
+func (s *Scheduler) emitPositionsLocked() {
+	if s.onEvent == nil {
+		return
+	}
+	queued := s.queuedLocked()
+	pos := 0
+	for p := numPriorities - 1; p >= 0; p-- {
+		for _, t := range s.queues[p] {
+			pos++
+			s.emitLocked(QueueEvent{ID: t.id, Source: t.source, Position: pos, Queued: queued})
+		}
+	}
+}
+
+func (s *Scheduler) emitLocked(ev QueueEvent) {
+	if s.onEvent != nil {
+		s.onEvent("ollama:queue", ev)
+	}
+}
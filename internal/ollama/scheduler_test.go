@@ -0,0 +1,79 @@
+package ollama_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"DubaiCrab/internal/ollama"
+)
+
+func TestSchedulerPriority(t *testing.T) {
+	s := ollama.NewScheduler(1, nil)
+	ctx := context.Background()
+
+	release, err := s.Acquire(ctx, ollama.SourceBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan ollama.Source, 3)
+	var wg sync.WaitGroup
+	for i, src := range []ollama.Source{ollama.SourceBatch, ollama.SourceKakao, ollama.SourceDesktop} {
+		wg.Add(1)
+		go func(src ollama.Source) {
+			defer wg.Done()
+			r, err := s.Acquire(ctx, src)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- src
+			r()
+		}(src)
+		waitQueued(t, s, i+1)
+	}
+
+	release()
+	wg.Wait()
+	close(order)
+
+	want := []ollama.Source{ollama.SourceDesktop, ollama.SourceKakao, ollama.SourceBatch}
+	i := 0
+	for src := range order {
+		if src != want[i] {
+			t.Errorf("served #%d = %s, want %s", i, src, want[i])
+		}
+		i++
+	}
+}
+
+func TestSchedulerQueueFull(t *testing.T) {
+	s := ollama.NewScheduler(1, map[ollama.Source]int{ollama.SourceKakao: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release, _ := s.Acquire(ctx, ollama.SourceDesktop)
+	defer release()
+
+	go s.Acquire(ctx, ollama.SourceKakao)
+	waitQueued(t, s, 1)
+
+	if _, err := s.Acquire(ctx, ollama.SourceKakao); !errors.Is(err, ollama.ErrQueueFull) {
+		t.Errorf("Acquire = %v, want ErrQueueFull", err)
+	}
+}
+
+func waitQueued(t *testing.T, s *ollama.Scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, queued := s.Stats(); queued >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued requests", n)
+}
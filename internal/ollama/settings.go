@@ -0,0 +1,140 @@
+package ollama
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Settings holds how the manager reaches Ollama and how it runs the
+// managed `ollama serve` process
+type Settings struct {
+	// BaseURL of the Ollama API, local or remote
+	BaseURL string
+
+	// Optional credentials for a remote Ollama behind a reverse proxy.
+	// BearerToken takes precedence over basic auth.
+	Username    string
+	Password    string
+	BearerToken string
+
+	// KeepAlive is sent with every request to control how long the model
+	// stays loaded, e.g. "30m" or "-1" to keep it loaded indefinitely
+	KeepAlive string
+
+	// Env is applied to the managed server process only
+	Env ServerEnv
+}
+
+// ServerEnv holds environment variables for the managed Ollama process
+type ServerEnv struct {
+	Models          string // OLLAMA_MODELS
+	Host            string // OLLAMA_HOST
+	KeepAlive       string // OLLAMA_KEEP_ALIVE
+	NumParallel     int    // OLLAMA_NUM_PARALLEL
+	MaxLoadedModels int    // OLLAMA_MAX_LOADED_MODELS
+}
+
+// environ returns the variables as KEY=value pairs, skipping unset values
+func (e ServerEnv) environ() []string {
+	var env []string
+	if e.Models != "" {
+		env = append(env, "OLLAMA_MODELS="+e.Models)
+	}
+	if e.Host != "" {
+		env = append(env, "OLLAMA_HOST="+e.Host)
+	}
+	if e.KeepAlive != "" {
+		env = append(env, "OLLAMA_KEEP_ALIVE="+e.KeepAlive)
+	}
+	if e.NumParallel > 0 {
+		env = append(env, "OLLAMA_NUM_PARALLEL="+strconv.Itoa(e.NumParallel))
+	}
+	if e.MaxLoadedModels > 0 {
+		env = append(env, "OLLAMA_MAX_LOADED_MODELS="+strconv.Itoa(e.MaxLoadedModels))
+	}
+	return env
+}
+
+// Configure applies connection and server settings. Server environment
+// changes take effect the next time the managed process starts.
+func (m *Manager) Configure(settings Settings) {
+	settings.BaseURL = strings.TrimRight(strings.TrimSpace(settings.BaseURL), "/")
+	if settings.BaseURL == "" {
+		settings.BaseURL = defaultBaseURL
+	}
+
+	m.settingsMu.Lock()
+	defer m.settingsMu.Unlock()
+	m.settings = settings
+}
+
+// BaseURL returns the configured Ollama URL
+func (m *Manager) BaseURL() string {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+	return m.settings.BaseURL
+}
+
+// IsLocal reports whether the configured Ollama URL points at this machine,
+// in which case the manager may run the server itself
+func (m *Manager) IsLocal() bool {
+	u, err := url.Parse(m.BaseURL())
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+// newRequest builds an API request against the configured URL with auth
+func (m *Manager) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	m.settingsMu.RLock()
+	settings := m.settings
+	m.settingsMu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, method, settings.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	switch {
+	case settings.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+settings.BearerToken)
+	case settings.Username != "":
+		req.SetBasicAuth(settings.Username, settings.Password)
+	}
+
+	return req, nil
+}
+
+// serverEnv returns the environment for the managed process. If OLLAMA_HOST
+// is not set explicitly it is derived from the configured URL so the server
+// listens where the manager connects.
+func (m *Manager) serverEnv() []string {
+	m.settingsMu.RLock()
+	settings := m.settings
+	m.settingsMu.RUnlock()
+
+	env := settings.Env
+	if env.Host == "" {
+		if u, err := url.Parse(settings.BaseURL); err == nil && u.Port() != "" && u.Port() != "11434" {
+			env.Host = fmt.Sprintf("%s:%s", u.Hostname(), u.Port())
+		}
+	}
+	return env.environ()
+}
@@ -0,0 +1,216 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	logBufferLines    = 1000
+	restartBaseDelay  = 1 * time.Second
+	restartMaxDelay   = 60 * time.Second
+	restartResetAfter = 2 * time.Minute
+)
+
+// CrashEvent is emitted as "ollama:crashed" when the managed process exits
+// unexpectedly
+type CrashEvent struct {
+	Error      string `json:"error"`
+	Restarts   int    `json:"restarts"`
+	RetryInMs  int64  `json:"retryInMs"`
+	UptimeSecs int64  `json:"uptimeSecs"`
+}
+
+// RestartEvent is emitted as "ollama:restarted" once the process is back up
+type RestartEvent struct {
+	Restarts int `json:"restarts"`
+}
+
+// logBuffer is an io.Writer that keeps the last N lines written to it
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte // bytes after the last newline, possibly a split rune
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{lines: make([]string, size)}
+}
+
+// Write implements io.Writer, splitting the input into lines
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Split on bytes so a multibyte rune cut across writes is kept whole
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		b.appendLocked(string(b.partial[:i]))
+		b.partial = b.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Printf appends a supervisor note to the log
+func (b *logBuffer) Printf(format string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.appendLocked(fmt.Sprintf("%s [supervisor] %s", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...)))
+}
+
+func (b *logBuffer) appendLocked(line string) {
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns the buffered lines, oldest first
+func (b *logBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []string
+	if b.full {
+		out = append(out, b.lines[b.next:]...)
+	}
+	out = append(out, b.lines[:b.next]...)
+	if len(b.partial) > 0 {
+		out = append(out, string(b.partial))
+	}
+	return out
+}
+
+// Logs returns the most recent output of the managed Ollama process
+func (m *Manager) Logs() []string {
+	return m.logs.Lines()
+}
+
+// spawnLocked starts `ollama serve` and a goroutine supervising it.
+// m.mu must be held.
+func (m *Manager) spawnLocked(ctx context.Context, ollamaPath string, stop <-chan struct{}) error {
+	cmd := exec.CommandContext(ctx, ollamaPath, "serve")
+	cmd.Env = append(os.Environ(), m.serverEnv()...)
+	cmd.Stdout = m.logs
+	cmd.Stderr = m.logs
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Ollama: %w", err)
+	}
+
+	exited := make(chan struct{})
+	m.process = cmd
+	m.exited = exited
+	m.logs.Printf("started ollama serve (pid %d)", cmd.Process.Pid)
+
+	go m.supervise(ctx, ollamaPath, cmd, exited, stop)
+	return nil
+}
+
+// supervise waits for the process to exit and restarts it with backoff
+// unless it was stopped on purpose
+func (m *Manager) supervise(ctx context.Context, ollamaPath string, cmd *exec.Cmd, exited chan struct{}, stop <-chan struct{}) {
+	started := time.Now()
+	err := cmd.Wait()
+	close(exited)
+
+	uptime := time.Since(started)
+
+	m.mu.Lock()
+	if m.process != cmd || isClosed(stop) || ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.process = nil
+	if uptime > restartResetAfter {
+		m.restarts = 0
+	}
+	restarts := m.restarts
+	m.mu.Unlock()
+
+	reason := "exited"
+	if err != nil {
+		reason = err.Error()
+	}
+
+	for {
+		delay := restartBaseDelay << restarts
+		if delay > restartMaxDelay || delay <= 0 {
+			delay = restartMaxDelay
+		}
+
+		log.Printf("[ollama] Process %s, restarting in %s", reason, delay)
+		m.logs.Printf("process %s after %s, restarting in %s", reason, uptime.Round(time.Second), delay)
+		m.emit("ollama:crashed", CrashEvent{
+			Error:      reason,
+			Restarts:   restarts,
+			RetryInMs:  delay.Milliseconds(),
+			UptimeSecs: int64(uptime.Seconds()),
+		})
+
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		restarts++
+
+		m.mu.Lock()
+		if isClosed(stop) {
+			m.mu.Unlock()
+			return
+		}
+		m.restarts = restarts
+		if m.IsRunning() {
+			// Another Ollama instance took over the port
+			m.mu.Unlock()
+			m.logs.Printf("an external Ollama server is running, not restarting")
+			m.emit("ollama:restarted", RestartEvent{Restarts: restarts})
+			return
+		}
+		if err := m.spawnLocked(ctx, ollamaPath, stop); err != nil {
+			m.mu.Unlock()
+			reason = err.Error()
+			uptime = 0
+			continue
+		}
+		m.mu.Unlock()
+
+		if err := m.waitForReady(ctx, startupTimeout); err != nil {
+			// The new process has its own supervisor; if it dies the
+			// backoff continues from there
+			m.logs.Printf("restarted process not ready: %v", err)
+			return
+		}
+
+		log.Printf("[ollama] Process restarted (attempt %d)", restarts)
+		m.logs.Printf("process restarted (attempt %d)", restarts)
+		m.emit("ollama:restarted", RestartEvent{Restarts: restarts})
+		return
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,20 @@
+package ollama
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLogBufferSplitRunes(t *testing.T) {
+	b := newLogBuffer(10)
+	line := []byte("모델 로드 완료\nnext")
+	// Feed one byte at a time so every multibyte rune is split
+	for i := range line {
+		b.Write(line[i : i+1])
+	}
+
+	want := []string{"모델 로드 완료", "next"}
+	if got := b.Lines(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lines() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package ollama
+
+import (
+	"context"
+	"time"
+
+	"DubaiCrab/internal/usage"
+)
+
+// Metrics are the timing and token fields Ollama reports on a finished
+// generation. Durations are in nanoseconds.
+type Metrics struct {
+	TotalDuration      int64 `json:"total_duration"`
+	LoadDuration       int64 `json:"load_duration"`
+	PromptEvalCount    int   `json:"prompt_eval_count"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration"`
+	EvalCount          int   `json:"eval_count"`
+	EvalDuration       int64 `json:"eval_duration"`
+}
+
+// UsageRecorder receives a record for every LLM call
+type UsageRecorder interface {
+	Record(r usage.Record)
+}
+
+// SetUsageRecorder sets where LLM call usage is recorded
+func (m *Manager) SetUsageRecorder(r UsageRecorder) {
+	m.eventMu.Lock()
+	defer m.eventMu.Unlock()
+	m.usage = r
+}
+
+// recordUsage reports a finished call to the usage recorder, if any
+func (m *Manager) recordUsage(ctx context.Context, kind, model string, start time.Time, metrics Metrics, cached bool, err error) {
+	m.eventMu.RLock()
+	recorder := m.usage
+	m.eventMu.RUnlock()
+	if recorder == nil {
+		return
+	}
+
+	r := usage.Record{
+		Time:         start,
+		Model:        model,
+		Source:       string(SourceFromContext(ctx)),
+		Kind:         kind,
+		PromptTokens: metrics.PromptEvalCount,
+		EvalTokens:   metrics.EvalCount,
+		LatencyMs:    time.Since(start).Milliseconds(),
+		TotalMs:      time.Duration(metrics.TotalDuration).Milliseconds(),
+		LoadMs:       time.Duration(metrics.LoadDuration).Milliseconds(),
+		PromptEvalMs: time.Duration(metrics.PromptEvalDuration).Milliseconds(),
+		EvalMs:       time.Duration(metrics.EvalDuration).Milliseconds(),
+		Cached:       cached,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	recorder.Record(r)
+}
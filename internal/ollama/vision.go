@@ -0,0 +1,114 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ModelInfo holds the parts of /api/show the app cares about
+type ModelInfo struct {
+	Capabilities []string `json:"capabilities"`
+	Details      struct {
+		Family   string   `json:"family"`
+		Families []string `json:"families"`
+	} `json:"details"`
+}
+
+// visionModelHints are name fragments of known vision models, used when the
+// server is too old to report capabilities
+var visionModelHints = []string{
+	"llava",
+	"bakllava",
+	"moondream",
+	"minicpm-v",
+	"qwen2-vl",
+	"qwen2.5vl",
+	"qwen2.5-vl",
+	"llama3.2-vision",
+	"gemma3",
+	"-vision",
+}
+
+// ShowModel returns model metadata from /api/show
+func (m *Manager) ShowModel(name string) (*ModelInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), listModelsTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]string{"model": name})
+	req, err := m.newRequest(ctx, "POST", "/api/show", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to show model %s: HTTP %d", name, resp.StatusCode)
+	}
+
+	var info ModelInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &info, nil
+}
+
+// SupportsVision reports whether a model accepts image input. Results are
+// cached per model name.
+func (m *Manager) SupportsVision(model string) bool {
+	m.visionMu.Lock()
+	if v, ok := m.visionCache[model]; ok {
+		m.visionMu.Unlock()
+		return v
+	}
+	m.visionMu.Unlock()
+
+	supported := false
+	info, err := m.ShowModel(model)
+	switch {
+	case err == nil && len(info.Capabilities) > 0:
+		for _, c := range info.Capabilities {
+			if c == "vision" {
+				supported = true
+				break
+			}
+		}
+	case err == nil:
+		// Older servers report the CLIP projector as a model family
+		for _, f := range append(info.Details.Families, info.Details.Family) {
+			if f == "clip" || f == "mllama" {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			supported = hasVisionHint(model)
+		}
+	default:
+		// Don't cache lookup failures
+		return hasVisionHint(model)
+	}
+
+	m.visionMu.Lock()
+	m.visionCache[model] = supported
+	m.visionMu.Unlock()
+	return supported
+}
+
+func hasVisionHint(model string) bool {
+	name := strings.ToLower(model)
+	for _, hint := range visionModelHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package ollama_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"DubaiCrab/internal/ollama"
+)
+
+// showServer answers /api/show with the given metadata per model and fails
+// for models it doesn't know
+func showServer(t *testing.T, models map[string]string) *ollama.Manager {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		info, ok := models[req.Model]
+		if r.URL.Path != "/api/show" || !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(info))
+	}))
+	t.Cleanup(srv.Close)
+
+	m := ollama.NewManager()
+	m.SetBaseURL(srv.URL)
+	return m
+}
+
+func TestSupportsVision(t *testing.T) {
+	m := showServer(t, map[string]string{
+		"qwen2.5:0.5b": `{"capabilities":["completion"]}`,
+		"llava:7b":     `{"capabilities":["completion","vision"]}`,
+		"old-vlm":      `{"details":{"family":"llama","families":["llama","clip"]}}`,
+		"old-text":     `{"details":{"family":"llama","families":["llama"]}}`,
+	})
+
+	for model, want := range map[string]bool{
+		"qwen2.5:0.5b": false,
+		"llava:7b":     true,
+		"old-vlm":      true,
+		"old-text":     false,
+	} {
+		if got := m.SupportsVision(model); got != want {
+			t.Errorf("SupportsVision(%s) = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestSupportsVisionFallsBackToName(t *testing.T) {
+	// Models the server can't describe are judged by name, so images go to
+	// OCR unless the name marks a vision model
+	m := showServer(t, nil)
+	if !m.SupportsVision("llama3.2-vision:11b") {
+		t.Error("llama3.2-vision not reported as vision model")
+	}
+	if m.SupportsVision("qwen2.5:3b") {
+		t.Error("qwen2.5 reported as vision model")
+	}
+}
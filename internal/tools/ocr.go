@@ -134,13 +134,7 @@ func OcrFromBase64(base64Data, lang string) OcrResult {
 		return OcrResult{Success: false, Error: &errStr}
 	}
 
-	// Strip data URL prefix if present
-	if strings.HasPrefix(base64Data, "data:") {
-		parts := strings.SplitN(base64Data, ",", 2)
-		if len(parts) == 2 {
-			base64Data = parts[1]
-		}
-	}
+	base64Data = StripDataURL(base64Data)
 
 	// Decode base64
 	imgData, err := base64.StdEncoding.DecodeString(base64Data)
@@ -168,6 +162,37 @@ func OcrFromBase64(base64Data, lang string) OcrResult {
 	return OcrFromFile(tmpFile.Name(), lang)
 }
 
+// StripDataURL removes a "data:image/...;base64," prefix if present
+func StripDataURL(base64Data string) string {
+	if strings.HasPrefix(base64Data, "data:") {
+		parts := strings.SplitN(base64Data, ",", 2)
+		if len(parts) == 2 {
+			return parts[1]
+		}
+	}
+	return base64Data
+}
+
+// LoadImageBase64 reads an image file after validating its path and returns
+// it base64-encoded (e.g. for vision models)
+func LoadImageBase64(imagePath string) (string, error) {
+	validPath, err := validateImagePath(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(validPath)
+	if err != nil {
+		return "", fmt.Errorf("이미지 읽기 실패: %v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if len(encoded) > maxBase64Size {
+		return "", fmt.Errorf("이미지 크기가 제한을 초과합니다 (최대 10MB)")
+	}
+	return encoded, nil
+}
+
 // validateImagePath validates the image path for security
 func validateImagePath(imagePath string) (string, error) {
 	// Expand home directory
@@ -0,0 +1,262 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dayLayout = "2006-01-02"
+
+// DefaultRetentionDays is how long day files are kept unless configured
+const DefaultRetentionDays = 90
+
+// Record is a single LLM call
+type Record struct {
+	Time         time.Time `json:"time"`
+	Model        string    `json:"model"`
+	Source       string    `json:"source"`
+	Kind         string    `json:"kind"` // "chat", "generate", "embed"
+	PromptTokens int       `json:"promptTokens"`
+	EvalTokens   int       `json:"evalTokens"`
+	LatencyMs    int64     `json:"latencyMs"` // wall clock, including queueing
+	TotalMs      int64     `json:"totalMs"`
+	LoadMs       int64     `json:"loadMs"`
+	PromptEvalMs int64     `json:"promptEvalMs"`
+	EvalMs       int64     `json:"evalMs"`
+	Cached       bool      `json:"cached,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Aggregate summarizes a group of records
+type Aggregate struct {
+	Key          string  `json:"key"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	CacheHits    int     `json:"cacheHits"`
+	PromptTokens int     `json:"promptTokens"`
+	EvalTokens   int     `json:"evalTokens"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+	MaxLatencyMs int64   `json:"maxLatencyMs"`
+	// TokensPerSec is the average generation speed over successful calls
+	TokensPerSec float64 `json:"tokensPerSec"`
+
+	latencySum int64
+	evalMsSum  int64
+}
+
+// Stats holds aggregates for a time range
+type Stats struct {
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Total    Aggregate   `json:"total"`
+	ByDay    []Aggregate `json:"byDay"`
+	ByModel  []Aggregate `json:"byModel"`
+	BySource []Aggregate `json:"bySource"`
+}
+
+// Store persists records as one JSON-lines file per day
+type Store struct {
+	dir           string
+	mu            sync.Mutex
+	retentionDays int
+	prunedDay     string // day of the last prune, so it runs once a day
+}
+
+// NewStore creates a store in dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, retentionDays: DefaultRetentionDays}
+}
+
+// SetRetention sets how many days of records are kept; 0 keeps everything
+func (s *Store) SetRetention(days int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retentionDays = days
+	s.prunedDay = ""
+}
+
+// DefaultDir returns the default usage directory
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "dubai-crab", "usage"), nil
+}
+
+// Record appends a record to the file for its day
+func (s *Store) Record(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return
+	}
+	if day := r.Time.Local().Format(dayLayout); day != s.prunedDay {
+		s.pruneLocked(r.Time)
+		s.prunedDay = day
+	}
+
+	f, err := os.OpenFile(s.dayPath(r.Time), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	f.Write(append(data, '\n'))
+}
+
+// Stats aggregates records with from <= Time < to per day, model and source
+func (s *Store) Stats(from, to time.Time) (*Stats, error) {
+	stats := &Stats{From: from, To: to, Total: Aggregate{Key: "total"}}
+	byDay := make(map[string]*Aggregate)
+	byModel := make(map[string]*Aggregate)
+	bySource := make(map[string]*Aggregate)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for day := truncateDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		err := s.readDay(day, func(r Record) {
+			if r.Time.Before(from) || !r.Time.Before(to) {
+				return
+			}
+			stats.Total.add(r)
+			group(byDay, r.Time.Format(dayLayout)).add(r)
+			group(byModel, r.Model).add(r)
+			group(bySource, r.Source).add(r)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stats.Total.finish()
+	stats.ByDay = sorted(byDay)
+	stats.ByModel = sorted(byModel)
+	stats.BySource = sorted(bySource)
+	return stats, nil
+}
+
+// Prune deletes the day files older than the retention period
+func (s *Store) Prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+}
+
+func (s *Store) pruneLocked(now time.Time) {
+	if s.retentionDays <= 0 {
+		return
+	}
+	cutoff := truncateDay(now).AddDate(0, 0, -s.retentionDays).Format(dayLayout)
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		day := strings.TrimSuffix(e.Name(), ".jsonl")
+		if e.IsDir() || day == e.Name() || day >= cutoff {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, e.Name())); err != nil {
+			log.Printf("[usage] Failed to prune %s: %v", e.Name(), err)
+		}
+	}
+}
+
+// readDay calls fn for every record in a day file
+func (s *Store) readDay(day time.Time, fn func(Record)) error {
+	f, err := os.Open(s.dayPath(day))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			fn(r)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Store) dayPath(t time.Time) string {
+	return filepath.Join(s.dir, t.Local().Format(dayLayout)+".jsonl")
+}
+
+func (a *Aggregate) add(r Record) {
+	a.Requests++
+	if r.Error != "" {
+		a.Errors++
+	}
+	if r.Cached {
+		a.CacheHits++
+	}
+	a.PromptTokens += r.PromptTokens
+	a.EvalTokens += r.EvalTokens
+	a.latencySum += r.LatencyMs
+	if r.LatencyMs > a.MaxLatencyMs {
+		a.MaxLatencyMs = r.LatencyMs
+	}
+	a.evalMsSum += r.EvalMs
+}
+
+func (a *Aggregate) finish() {
+	if a.Requests > 0 {
+		a.AvgLatencyMs = float64(a.latencySum) / float64(a.Requests)
+	}
+	if a.evalMsSum > 0 {
+		a.TokensPerSec = float64(a.EvalTokens) / (float64(a.evalMsSum) / 1000)
+	}
+}
+
+func group(m map[string]*Aggregate, key string) *Aggregate {
+	if key == "" {
+		key = "unknown"
+	}
+	a, ok := m[key]
+	if !ok {
+		a = &Aggregate{Key: key}
+		m[key] = a
+	}
+	return a
+}
+
+func sorted(m map[string]*Aggregate) []Aggregate {
+	out := make([]Aggregate, 0, len(m))
+	for _, a := range m {
+		a.finish()
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
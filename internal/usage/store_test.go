@@ -0,0 +1,115 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	s := NewStore(t.TempDir())
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+
+	s.Record(Record{Time: yesterday, Model: "a", Source: "kakao", PromptTokens: 10, EvalTokens: 20, LatencyMs: 100, EvalMs: 1000})
+	s.Record(Record{Time: now, Model: "a", Source: "desktop", PromptTokens: 5, EvalTokens: 40, LatencyMs: 300, EvalMs: 2000})
+	s.Record(Record{Time: now, Model: "b", Source: "kakao", LatencyMs: 50, Error: "boom"})
+
+	stats, err := s.Stats(yesterday.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+
+	if stats.Total.Requests != 3 || stats.Total.Errors != 1 || stats.Total.EvalTokens != 60 {
+		t.Errorf("total = %+v", stats.Total)
+	}
+	if stats.Total.AvgLatencyMs != 150 || stats.Total.MaxLatencyMs != 300 {
+		t.Errorf("latency = avg %v max %v", stats.Total.AvgLatencyMs, stats.Total.MaxLatencyMs)
+	}
+	if stats.Total.TokensPerSec != 20 {
+		t.Errorf("tokens/sec = %v, want 20", stats.Total.TokensPerSec)
+	}
+	if len(stats.ByDay) != 2 || len(stats.ByModel) != 2 || len(stats.BySource) != 2 {
+		t.Errorf("groups: %d days, %d models, %d sources", len(stats.ByDay), len(stats.ByModel), len(stats.BySource))
+	}
+	if stats.BySource[1].Key != "kakao" || stats.BySource[1].Requests != 2 {
+		t.Errorf("kakao group = %+v", stats.BySource[1])
+	}
+
+	// Range excludes yesterday
+	stats, _ = s.Stats(now.Add(-time.Minute), now.Add(time.Minute))
+	if stats.Total.Requests != 2 {
+		t.Errorf("today requests = %d, want 2", stats.Total.Requests)
+	}
+}
+
+func TestStatsGroups(t *testing.T) {
+	s := NewStore(t.TempDir())
+	now := time.Now()
+	day := func(offset int) time.Time { return now.AddDate(0, 0, offset) }
+
+	s.Record(Record{Time: day(-2), Model: "a", Source: "kakao", EvalTokens: 10, LatencyMs: 100})
+	s.Record(Record{Time: day(-2), Model: "b", Source: "desktop", EvalTokens: 20, LatencyMs: 200, Cached: true})
+	s.Record(Record{Time: day(-1), Model: "a", Source: "kakao", EvalTokens: 30, LatencyMs: 300, Error: "boom"})
+	s.Record(Record{Time: now, Model: "a", Source: "agent", Kind: "embed", PromptTokens: 4, LatencyMs: 40})
+
+	stats, err := s.Stats(day(-2).Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+
+	byKey := func(groups []Aggregate) map[string]Aggregate {
+		out := make(map[string]Aggregate)
+		for _, g := range groups {
+			out[g.Key] = g
+		}
+		return out
+	}
+
+	days := byKey(stats.ByDay)
+	if len(days) != 3 {
+		t.Fatalf("days = %+v", stats.ByDay)
+	}
+	if d := days[day(-2).Format(dayLayout)]; d.Requests != 2 || d.EvalTokens != 30 || d.CacheHits != 1 || d.AvgLatencyMs != 150 {
+		t.Errorf("two days ago = %+v", d)
+	}
+	if d := days[day(-1).Format(dayLayout)]; d.Requests != 1 || d.Errors != 1 {
+		t.Errorf("yesterday = %+v", d)
+	}
+	if stats.ByDay[0].Key > stats.ByDay[2].Key {
+		t.Errorf("days not sorted: %+v", stats.ByDay)
+	}
+
+	models := byKey(stats.ByModel)
+	if a := models["a"]; a.Requests != 3 || a.EvalTokens != 40 || a.PromptTokens != 4 || a.MaxLatencyMs != 300 {
+		t.Errorf("model a = %+v", a)
+	}
+	if b := models["b"]; b.Requests != 1 || b.CacheHits != 1 {
+		t.Errorf("model b = %+v", b)
+	}
+
+	sources := byKey(stats.BySource)
+	if len(sources) != 3 || sources["kakao"].Requests != 2 || sources["desktop"].Requests != 1 || sources["agent"].Requests != 1 {
+		t.Errorf("sources = %+v", stats.BySource)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+	s.SetRetention(7)
+	now := time.Now()
+
+	s.Record(Record{Time: now.AddDate(0, 0, -30), Model: "a"})
+	s.Record(Record{Time: now.AddDate(0, 0, -3), Model: "a"})
+	s.Record(Record{Time: now, Model: "a"})
+
+	if _, err := os.Stat(filepath.Join(dir, now.AddDate(0, 0, -30).Format(dayLayout)+".jsonl")); !os.IsNotExist(err) {
+		t.Errorf("old day file not pruned: %v", err)
+	}
+	stats, _ := s.Stats(now.AddDate(0, 0, -31), now.Add(time.Minute))
+	if stats.Total.Requests != 2 {
+		t.Errorf("requests after prune = %d, want 2", stats.Total.Requests)
+	}
+}